@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"greenlight.alexedwards.net/internal/data"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+// maxBatchOperations limits how much work a single batch request can do
+const maxBatchOperations = 100
+
+// batchMovieInput is the movie body of a create or update operation, the same as for POST /v1/movies
+type batchMovieInput struct {
+	Title   string       `json:"title"`
+	Year    int32        `json:"year"`
+	Runtime data.Runtime `json:"runtime"`
+	Genres  []string     `json:"genres"`
+
+	// left out of an update, the movie keeps the external ids it has
+	ExternalIDs *data.ExternalIDs `json:"external_ids"`
+}
+
+// batchOperation is one entry of a batch request
+type batchOperation struct {
+	Op    string           `json:"op"`
+	ID    int64            `json:"id,omitempty"`
+	Movie *batchMovieInput `json:"movie,omitempty"`
+}
+
+// batchResult is the outcome of one operation, at the same index as in the request
+type batchResult struct {
+	Index   int               `json:"index"`
+	Op      string            `json:"op"`
+	Status  int               `json:"status"`
+	Movie   *data.Movie       `json:"movie,omitempty"`
+	Message string            `json:"message,omitempty"`
+	Errors  map[string]string `json:"errors,omitempty"`
+}
+
+// errBatchAborted rolls back an atomic batch once one of its operations fails
+var errBatchAborted = errors.New("batch aborted")
+
+func (app *application) batchHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Atomic     *bool            `json:"atomic"`
+		Operations []batchOperation `json:"operations"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(len(input.Operations) > 0, "operations", "must contain at least 1 operation")
+	v.Check(len(input.Operations) <= maxBatchOperations, "operations", fmt.Sprintf("must not contain more than %d operations", maxBatchOperations))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// all-or-nothing unless the client explicitly asks for best effort
+	atomic := input.Atomic == nil || *input.Atomic
+
+	genres, err := app.models.Genres.Index()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// check every operation before touching the database
+	results := make([]*batchResult, len(input.Operations))
+	movies := make([]*data.Movie, len(input.Operations))
+	invalid := false
+	for i, op := range input.Operations {
+		results[i] = &batchResult{Index: i, Op: op.Op}
+		movie, errs := validateBatchOperation(op, genres)
+		if errs != nil {
+			results[i].Status = http.StatusUnprocessableEntity
+			results[i].Errors = errs
+			invalid = true
+			continue
+		}
+		movies[i] = movie
+	}
+
+	// an atomic batch with an invalid operation never starts
+	if atomic && invalid {
+		markNotApplied(results)
+		err = app.writeJSON(w, r, http.StatusUnprocessableEntity, envelope{"atomic": atomic, "results": results}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.modelsFor(r).Transaction(func(tx data.Models) error {
+		for i, op := range input.Operations {
+			if results[i].Status != 0 {
+				continue
+			}
+
+			// in best effort mode a failed operation only undoes itself
+			err := tx.Savepoint(func() error {
+				return app.runBatchOperation(tx, op, movies[i], results[i])
+			})
+
+			switch {
+			case err == nil:
+			case errors.Is(err, data.ErrorRecordNotFound):
+				results[i].Status = http.StatusNotFound
+				results[i].Message = "the requested resource could not be found"
+			case errors.Is(err, data.ErrDuplicateExternalID):
+				results[i].Status = http.StatusUnprocessableEntity
+				results[i].Errors = map[string]string{"external_ids": err.Error()}
+			case atomic || errors.Is(err, data.ErrSavepointFailed):
+				return err
+			default:
+				// the savepoint undid the operation, so in best effort mode the
+				// rest of the batch carries on without it
+				app.logError(r, err)
+				results[i].Status = http.StatusInternalServerError
+				results[i].Message = "the server encountered a problem and could not process this operation"
+			}
+
+			if atomic && results[i].Status >= http.StatusBadRequest {
+				return errBatchAborted
+			}
+		}
+		return nil
+	})
+
+	status := http.StatusOK
+	switch {
+	case errors.Is(err, errBatchAborted):
+		markNotApplied(results)
+		status = http.StatusUnprocessableEntity
+	case err != nil:
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, status, envelope{"atomic": atomic, "results": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// validateBatchOperation() checks an operation and returns the movie it would
+// write, or the validation errors keyed like a normal failed validation response
+func validateBatchOperation(op batchOperation, genres *data.GenreIndex) (*data.Movie, map[string]string) {
+	v := validator.New()
+	v.Check(validator.In(op.Op, "create", "update", "delete"), "op", "must be one of create, update or delete")
+
+	if op.Op == "update" || op.Op == "delete" {
+		v.Check(op.ID > 0, "id", "must be a positive integer")
+	}
+	if op.Op == "create" {
+		v.Check(op.ID == 0, "id", "must not be provided")
+	}
+	if op.Op == "delete" {
+		v.Check(op.Movie == nil, "movie", "must not be provided")
+	}
+	if !v.Valid() {
+		return nil, v.Errors
+	}
+	if op.Op == "delete" {
+		return nil, nil
+	}
+
+	if op.Movie == nil {
+		v.AddError("movie", "must be provided")
+		return nil, v.Errors
+	}
+	movie := &data.Movie{
+		ID:      op.ID,
+		Title:   op.Movie.Title,
+		Year:    op.Movie.Year,
+		Runtime: op.Movie.Runtime,
+		Genres:  op.Movie.Genres,
+	}
+	if op.Movie.ExternalIDs != nil {
+		movie.ExternalIDs = *op.Movie.ExternalIDs
+	}
+	if data.ValidateMovie(v, movie, genres); !v.Valid() {
+		return nil, v.Errors
+	}
+	return movie, nil
+}
+
+// runBatchOperation() carries out one validated operation and fills in its result
+func (app *application) runBatchOperation(tx data.Models, op batchOperation, movie *data.Movie, result *batchResult) error {
+	switch op.Op {
+	case "create":
+		if err := tx.Movies.Insert(movie); err != nil {
+			return err
+		}
+		result.Status = http.StatusCreated
+		result.Movie = movie
+
+	case "update":
+		existing, err := tx.Movies.Get(op.ID)
+		if err != nil {
+			return err
+		}
+		existing.Title = movie.Title
+		existing.Year = movie.Year
+		existing.Runtime = movie.Runtime
+		existing.Genres = movie.Genres
+		if op.Movie.ExternalIDs != nil {
+			existing.ExternalIDs = movie.ExternalIDs
+		}
+		if err := tx.Movies.Update(existing); err != nil {
+			return err
+		}
+		result.Status = http.StatusOK
+		result.Movie = existing
+
+	case "delete":
+		if err := tx.Movies.Delete(op.ID); err != nil {
+			return err
+		}
+		result.Status = http.StatusOK
+		result.Message = "movie successfully deleted"
+	}
+	return nil
+}
+
+// markNotApplied() marks the results of a rolled back batch: operations that
+// had succeeded were undone and the rest never ran
+func markNotApplied(results []*batchResult) {
+	for _, result := range results {
+		if result.Status < http.StatusBadRequest {
+			result.Status = http.StatusFailedDependency
+			result.Movie = nil
+			result.Message = "not applied because another operation in the batch failed"
+		}
+	}
+}
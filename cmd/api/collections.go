@@ -0,0 +1,323 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"greenlight.alexedwards.net/internal/data"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+// collectionInput is the body of a create or update collection request
+type collectionInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// listCollectionsHandler returns a page of collections by name. Further pages
+// are reached with the cursors in the metadata and Link header, as for movies
+func (app *application) listCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	pageSize := app.readInt(qs, "page_size", 20, v)
+	v.Check(pageSize > 0, "page_size", "must be greater than zero")
+	v.Check(pageSize <= 100, "page_size", "must be a maximum of 100")
+
+	var cursor *data.Cursor
+	if s := app.readString(qs, "cursor", ""); s != "" {
+		var err error
+		cursor, err = app.decodeCursor(s)
+		if err != nil || cursor.Sort != "name" {
+			v.AddError("cursor", "is invalid")
+		}
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	collections, metadata, err := app.models.Collections.GetAll(pageSize, cursor)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	pagination, headers, err := app.paginationLinks(r, metadata)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"collections": collections, "metadata": pagination}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	var input collectionInput
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	collection := &data.Collection{
+		Name:        input.Name,
+		Description: input.Description,
+	}
+
+	v := validator.New()
+	if data.ValidateCollection(v, collection); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Collections.Insert(collection)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/collections/%d", collection.ID))
+
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"collection": collection}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showCollectionHandler returns a collection with its movies in order
+func (app *application) showCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	collection, err := app.models.Collections.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"collection": collection}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	collection, err := app.models.Collections.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input collectionInput
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	collection.Name = input.Name
+	collection.Description = input.Description
+
+	v := validator.New()
+	if data.ValidateCollection(v, collection); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Collections.Update(collection)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"collection": collection}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteCollectionHandler removes a collection but not the movies in it
+func (app *application) deleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Collections.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "collection successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// addCollectionMovieHandler adds a movie to a collection at position, or at the
+// end if position is left out
+func (app *application) addCollectionMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		MovieID  int64 `json:"movie_id"`
+		Position int   `json:"position"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.MovieID > 0, "movie_id", "must be a positive integer")
+	v.Check(input.Position >= 0, "position", "must not be negative")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Collections.AddMovie(id, input.MovieID, input.Position)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrMovieNotFound):
+			v.AddError("movie_id", "does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateCollectionMovie):
+			v.AddError("movie_id", "is already in the collection")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeCollection(w, r, http.StatusCreated, id)
+}
+
+// updateCollectionMovieHandler moves a movie to another position in the collection
+func (app *application) updateCollectionMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	movieID, err := strconv.ParseInt(httprouter.ParamsFromContext(r.Context()).ByName("movie_id"), 10, 64)
+	if err != nil || movieID < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Position int `json:"position"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check(input.Position > 0, "position", "must be greater than zero"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Collections.MoveMovie(id, movieID, input.Position)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeCollection(w, r, http.StatusOK, id)
+}
+
+func (app *application) removeCollectionMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	movieID, err := strconv.ParseInt(httprouter.ParamsFromContext(r.Context()).ByName("movie_id"), 10, 64)
+	if err != nil || movieID < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Collections.RemoveMovie(id, movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeCollection(w, r, http.StatusOK, id)
+}
+
+// helper that sends the collection as it is after a change to its movies
+func (app *application) writeCollection(w http.ResponseWriter, r *http.Request, status int, id int64) {
+	collection, err := app.models.Collections.Get(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, status, envelope{"collection": collection}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -13,13 +13,21 @@ func (app *application) logError(r *http.Request, err error) {
 // helper to send json formatted error message
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message interface{}) {
 	env := envelope{"message": message}
-	err := app.writeJSON(w, status, env, nil)
+	err := app.writeJSON(w, r, status, env, nil)
 	if err != nil {
 		app.logError(r, err)
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
 
+// abortResponse() logs an error that happened after the status was sent and
+// drops the connection, so the client can't mistake the part of the body it
+// got for a complete response
+func (app *application) abortResponse(r *http.Request, err error) {
+	app.logError(r, err)
+	panic(http.ErrAbortHandler)
+}
+
 // helper that use logError() and errorResponse() helpers to log the error and send json server error to client
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logError(r, err)
@@ -48,3 +56,40 @@ func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Reques
 func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
 	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
 }
+
+// helper that use errorResponse() to send json not acceptable error when no offered format matches the Accept header
+func (app *application) notAcceptableResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the requested resource is only available as application/json, text/csv, application/xml or application/x-ndjson"
+	app.errorResponse(w, r, http.StatusNotAcceptable, message)
+}
+
+// helper that use errorResponse() to send json unsupported media type error when the request body format is not supported
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request) {
+	message := fmt.Sprintf("the %q content type is not supported for this resource", r.Header.Get("Content-Type"))
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, message)
+}
+
+// helper that use errorResponse() to send json conflict error when a record changed since the client read it
+func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
+	message := "unable to update the record due to an edit conflict, please try again"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// helper that use errorResponse() to send json unauthorized error when a list owner token is needed but missing or malformed
+func (app *application) invalidOwnerTokenResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	message := "invalid or missing owner token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// helper that use errorResponse() to send json error when an Idempotency-Key is reused for a different request
+func (app *application) idempotencyKeyMismatchResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the Idempotency-Key has already been used for a different request"
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, message)
+}
+
+// helper that use errorResponse() to send json conflict error while the first request with an Idempotency-Key is still running
+func (app *application) idempotencyKeyInProgressResponse(w http.ResponseWriter, r *http.Request) {
+	message := "a request with this Idempotency-Key is still being processed, please try again later"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAbortResponse(t *testing.T) {
+	app := &application{logger: log.New(io.Discard, "", 0)}
+	app.config.compress.minSize = 1024
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, `{"movies":[`+strings.Repeat(`{"id":1},`, 500))
+		w.(http.Flusher).Flush()
+		app.abortResponse(r, errors.New("row failed"))
+	}
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+	}{
+		{"plain", "identity"},
+		{"compressed", "gzip"},
+	}
+
+	srv := httptest.NewServer(app.compressResponse(http.HandlerFunc(handler)))
+	defer srv.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+
+			res, err := srv.Client().Do(req)
+			if err != nil {
+				return
+			}
+			defer res.Body.Close()
+
+			if _, err := io.ReadAll(res.Body); err == nil {
+				t.Error("read the whole body of an aborted response; want an error")
+			}
+		})
+	}
+}
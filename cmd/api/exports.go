@@ -0,0 +1,197 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"greenlight.alexedwards.net/internal/data"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+// exportFormats maps each export format to its Content-Type and file extension
+var exportFormats = map[string]struct {
+	mediaType string
+	extension string
+}{
+	formatNDJSON: {mediaTypes[formatNDJSON], "ndjson"},
+	formatCSV:    {mediaTypes[formatCSV], "csv"},
+	"tgz":        {"application/gzip", "tar.gz"},
+}
+
+// movieExporter writes an export as movies arrive from the database
+type movieExporter interface {
+	writeMovie(movie *data.Movie) error
+	close() error
+}
+
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	// read the optional genre and year range filters
+	var filter data.ExportFilter
+	genres, err := app.readGenres(qs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	filter.Genres = genres
+	filter.YearFrom = app.readInt(qs, "year_from", 0, v)
+	filter.YearTo = app.readInt(qs, "year_to", 0, v)
+
+	format := app.readString(qs, "format", formatNDJSON)
+	_, ok := exportFormats[format]
+	v.Check(ok, "format", "must be one of ndjson, csv or tgz")
+
+	if data.ValidateExportFilter(v, filter); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// an export can easily take longer than the server's write timeout
+	err = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// the headers are only sent once the first movie arrives, so a query that
+	// fails straight away still gets a proper error response
+	var exporter movieExporter
+	bw := bufio.NewWriter(w)
+	start := func() error {
+		filename := fmt.Sprintf("movies-%s.%s", time.Now().UTC().Format("20060102"), exportFormats[format].extension)
+		w.Header().Set("Content-Type", exportFormats[format].mediaType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+		w.WriteHeader(http.StatusOK)
+
+		var err error
+		exporter, err = newMovieExporter(bw, format)
+		return err
+	}
+
+	err = app.models.Movies.Export(r.Context(), filter, func(movie *data.Movie) error {
+		if exporter == nil {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		return exporter.writeMovie(movie)
+	})
+	if err != nil {
+		if exporter == nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		// the download is already under way, so it is cut off
+		app.abortResponse(r, err)
+	}
+
+	// nothing matched the filter: still send a valid, empty file
+	if exporter == nil {
+		if err := start(); err != nil {
+			app.abortResponse(r, err)
+		}
+	}
+
+	if err := exporter.close(); err != nil {
+		app.abortResponse(r, err)
+	}
+	if err := bw.Flush(); err != nil {
+		app.abortResponse(r, err)
+	}
+}
+
+// newMovieExporter() returns the exporter for the given format
+func newMovieExporter(bw *bufio.Writer, format string) (movieExporter, error) {
+	switch format {
+	case formatCSV:
+		cw := csv.NewWriter(bw)
+		if err := cw.Write(data.MovieFieldSafelist); err != nil {
+			return nil, err
+		}
+		return &csvExporter{cw}, nil
+	case "tgz":
+		gz := gzip.NewWriter(bw)
+		return &tarExporter{gz: gz, tw: tar.NewWriter(gz)}, nil
+	default:
+		return &ndjsonExporter{bw}, nil
+	}
+}
+
+// ndjsonExporter writes one compact JSON movie per line
+type ndjsonExporter struct {
+	w *bufio.Writer
+}
+
+func (e *ndjsonExporter) writeMovie(movie *data.Movie) error {
+	js, err := json.Marshal(movie)
+	if err != nil {
+		return err
+	}
+	e.w.Write(js)
+	return e.w.WriteByte('\n')
+}
+
+func (e *ndjsonExporter) close() error {
+	return nil
+}
+
+// csvExporter writes the same columns as the text/csv representation of the listing
+type csvExporter struct {
+	w *csv.Writer
+}
+
+func (e *csvExporter) writeMovie(movie *data.Movie) error {
+	record, err := movieCSVRecord(movie, data.MovieFieldSafelist)
+	if err != nil {
+		return err
+	}
+	return e.w.Write(record)
+}
+
+func (e *csvExporter) close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// tarExporter writes a gzipped tarball with one movies/<id>.json file per movie.
+// A tar header needs the file size up front, which is known for a single movie
+// but not for the whole export, hence a file each
+type tarExporter struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func (e *tarExporter) writeMovie(movie *data.Movie) error {
+	js, err := json.MarshalIndent(movie, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	header := &tar.Header{
+		Name:    fmt.Sprintf("movies/%d.json", movie.ID),
+		Mode:    0644,
+		Size:    int64(len(js)),
+		ModTime: movie.CreatedAt,
+	}
+	if err := e.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = e.tw.Write(js)
+	return err
+}
+
+func (e *tarExporter) close() error {
+	if err := e.tw.Close(); err != nil {
+		return err
+	}
+	return e.gz.Close()
+}
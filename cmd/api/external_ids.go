@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"greenlight.alexedwards.net/internal/data"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+// lookupMovieHandler finds the movie with an id from another database, as in
+// /v1/movies/lookup?source=imdb&id=tt0111161. The response points at the
+// movie's own URL in its Content-Location header
+func (app *application) lookupMovieHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	source := app.readString(qs, "source", "")
+	id := app.readString(qs, "id", "")
+
+	sources := make([]string, 0, len(data.ExternalIDSources))
+	for name := range data.ExternalIDSources {
+		sources = append(sources, name)
+	}
+	sort.Strings(sources)
+
+	v := validator.New()
+	v.Check(source != "", "source", "must be provided")
+	v.Check(id != "", "id", "must be provided")
+	if rx, ok := data.ExternalIDSources[source]; ok {
+		v.Check(id == "" || validator.Matches(id, rx), "id", fmt.Sprintf("is not a valid %s id", source))
+	} else if source != "" {
+		v.AddError("source", "must be one of "+strings.Join(sources, ", "))
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := app.models.Movies.GetByExternalID(source, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.localizeMovies(w, []*data.Movie{movie}, app.languages(w, r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Content-Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"greenlight.alexedwards.net/internal/data"
+)
+
+// the representations a movie resource can be sent in
+const (
+	formatJSON   = "json"
+	formatCSV    = "csv"
+	formatXML    = "xml"
+	formatNDJSON = "ndjson"
+)
+
+// csvListSeparator joins array values (such as genres) inside a single CSV cell
+const csvListSeparator = "|"
+
+// mediaTypes maps each format to the Content-Type it is sent with
+var mediaTypes = map[string]string{
+	formatJSON:   "application/json",
+	formatCSV:    "text/csv; charset=utf-8",
+	formatXML:    "application/xml; charset=utf-8",
+	formatNDJSON: "application/x-ndjson",
+}
+
+// acceptableTypes maps the media types we understand in an Accept header to a
+// format, in order of preference when the client rates several of them equally
+var acceptableTypes = []struct {
+	mediaType string
+	format    string
+}{
+	{"application/json", formatJSON},
+	{"text/csv", formatCSV},
+	{"application/xml", formatXML},
+	{"text/xml", formatXML},
+	{"application/x-ndjson", formatNDJSON},
+}
+
+// error returned when none of the formats we offer is acceptable to the client
+var errNotAcceptable = errors.New("not acceptable")
+
+// negotiateFormat() picks the format for a movie response. The ?format= query
+// parameter wins (so a browser link can download CSV), then the Accept header
+// is matched honouring q-values and wildcards. Each of our types gets the q of
+// the most specific range that covers it (RFC 7231 section 5.3.2), so
+// "text/*;q=0" rules out CSV unless text/csv is named itself. A client whose
+// favourite types are all ones we don't offer but that takes anything, as a
+// browser does, gets JSON. No Accept header means JSON
+func (app *application) negotiateFormat(r *http.Request) (string, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		if _, ok := mediaTypes[format]; !ok {
+			return "", errNotAcceptable
+		}
+		return format, nil
+	}
+
+	header := r.Header.Get("Accept")
+	if strings.TrimSpace(header) == "" {
+		return formatJSON, nil
+	}
+
+	// parse every media range with its q-value, noting the highest one given
+	type mediaRange struct {
+		name string
+		q    float64
+	}
+	var ranges []mediaRange
+	topQ := 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				parsed, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					parsed = 0
+				}
+				q = parsed
+			}
+		}
+		ranges = append(ranges, mediaRange{name, q})
+		topQ = max(topQ, q)
+	}
+
+	// find the most specific range covering each of our types; q=0 rules it out
+	type match struct {
+		format   string
+		q        float64
+		position int // of the range in the header, so earlier ranges win ties
+		wildcard bool
+	}
+	var matches []match
+	for _, acceptable := range acceptableTypes {
+		best, specificity := -1, -1
+		for i, mr := range ranges {
+			if s := mediaRangeSpecificity(mr.name); mediaRangeMatches(mr.name, acceptable.mediaType) && s > specificity {
+				best, specificity = i, s
+			}
+		}
+		if best >= 0 && ranges[best].q > 0 {
+			matches = append(matches, match{acceptable.format, ranges[best].q, best, specificity == 0})
+		}
+	}
+
+	// a client that most wants something we don't make but takes anything gets JSON
+	if !slices.ContainsFunc(matches, func(m match) bool { return m.q == topQ }) {
+		for _, m := range matches {
+			if m.format == formatJSON && m.wildcard {
+				return formatJSON, nil
+			}
+		}
+	}
+
+	// otherwise the highest q wins, then the earliest range, then our own order
+	var chosen *match
+	for i := range matches {
+		m := &matches[i]
+		if chosen == nil || m.q > chosen.q || (m.q == chosen.q && m.position < chosen.position) {
+			chosen = m
+		}
+	}
+	if chosen == nil {
+		return "", errNotAcceptable
+	}
+	return chosen.format, nil
+}
+
+// mediaRangeMatches() reports whether a range such as "text/*" covers the media type
+func mediaRangeMatches(mediaRange, mediaType string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(mediaRange, "/*")
+	return ok && strings.HasPrefix(mediaType, prefix+"/")
+}
+
+// mediaRangeSpecificity() ranks "*/*" below "text/*" below "text/csv"
+func mediaRangeSpecificity(mediaRange string) int {
+	switch {
+	case mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange, "/*"):
+		return 1
+	default:
+		return 2
+	}
+}
+
+// writeMovies() streams movies in a non-JSON format, calling next() until it
+// returns false. When list is false a single movie is written (XML then uses
+// <movie> as the root element instead of <movies>). Only the requested fields
+// are written, or every field when fields is empty. Each movie goes through its
+// JSON encoding first, so values such as Runtime look the same in every format
+func (app *application) writeMovies(w http.ResponseWriter, r *http.Request, format string, status int, list bool, next func() (*data.Movie, bool, error), fields []string, headers http.Header) error {
+	if len(fields) == 0 {
+		fields = data.MovieFieldSafelist
+	}
+
+	for k, v := range headers {
+		w.Header()[k] = v
+	}
+	w.Header().Set("Content-Type", mediaTypes[format])
+
+	// a ?format= link in a browser should download a file rather than display it
+	if r.URL.Query().Get("format") != "" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="movies.%s"`, format))
+	}
+	w.WriteHeader(status)
+
+	bw := bufio.NewWriter(w)
+	var err error
+	switch format {
+	case formatCSV:
+		err = writeMoviesCSV(bw, next, fields)
+	case formatXML:
+		err = writeMoviesXML(bw, next, fields, list)
+	case formatNDJSON:
+		err = writeMoviesNDJSON(bw, next, fields)
+	default:
+		err = fmt.Errorf("unsupported movie format %q", format)
+	}
+
+	if flushErr := bw.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+// writeMoviesCSV() writes a header row of field names followed by one row per movie
+func writeMoviesCSV(w *bufio.Writer, next func() (*data.Movie, bool, error), fields []string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(fields); err != nil {
+		return err
+	}
+
+	for {
+		movie, ok, err := next()
+		if err != nil || !ok {
+			cw.Flush()
+			return err
+		}
+
+		record, err := movieCSVRecord(movie, fields)
+		if err != nil {
+			return err
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+}
+
+// movieCSVRecord() returns the CSV cells of the given fields of a movie
+func movieCSVRecord(movie *data.Movie, fields []string) ([]string, error) {
+	values, err := movieJSONFields(movie)
+	if err != nil {
+		return nil, err
+	}
+
+	record := make([]string, len(fields))
+	for i, field := range fields {
+		record[i] = csvValue(values[field])
+	}
+	return record, nil
+}
+
+// csvValue() turns a decoded JSON value into the text of a CSV cell
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		// lists of plain values are joined, anything nested is kept as JSON
+		items := make([]string, len(v))
+		for i, item := range v {
+			if _, nested := item.(map[string]interface{}); nested {
+				js, _ := json.Marshal(v)
+				return string(js)
+			}
+			items[i] = csvValue(item)
+		}
+		return strings.Join(items, csvListSeparator)
+	default:
+		js, _ := json.Marshal(v)
+		return string(js)
+	}
+}
+
+// writeMoviesXML() writes <movies><movie>...</movie></movies>, or just
+// <movie>...</movie> when list is false
+func writeMoviesXML(w *bufio.Writer, next func() (*data.Movie, bool, error), fields []string, list bool) error {
+	w.WriteString(xml.Header)
+	enc := xml.NewEncoder(w)
+
+	root := xml.StartElement{Name: xml.Name{Local: "movies"}}
+	if list {
+		if err := enc.EncodeToken(root); err != nil {
+			return err
+		}
+	}
+
+	for {
+		movie, ok, err := next()
+		if err != nil {
+			enc.Flush()
+			return err
+		}
+		if !ok {
+			break
+		}
+
+		values, err := movieJSONFields(movie)
+		if err != nil {
+			return err
+		}
+
+		// keep only the requested fields, in the requested order
+		element := make([]xmlField, 0, len(fields))
+		for _, field := range fields {
+			if value, ok := values[field]; ok {
+				element = append(element, xmlField{field, value})
+			}
+		}
+		if err := encodeXMLValue(enc, "movie", element); err != nil {
+			return err
+		}
+	}
+
+	if list {
+		if err := enc.EncodeToken(root.End()); err != nil {
+			return err
+		}
+	}
+	return enc.Flush()
+}
+
+// xmlField is one child element of an XML object, kept in a slice to preserve order
+type xmlField struct {
+	name  string
+	value interface{}
+}
+
+// encodeXMLValue() writes a decoded JSON value as an element: objects become
+// child elements, arrays repeat a child named after the singular of the parent
+// (genres → genre) and everything else becomes the element's text
+func encodeXMLValue(enc *xml.Encoder, name string, value interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+
+	var children []xmlField
+	switch v := value.(type) {
+	case []xmlField:
+		children = v
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			children = append(children, xmlField{key, v[key]})
+		}
+	case []interface{}:
+		itemName := "item"
+		if singular, ok := strings.CutSuffix(name, "s"); ok && singular != "" {
+			itemName = singular
+		}
+		for _, item := range v {
+			children = append(children, xmlField{itemName, item})
+		}
+	case nil:
+		return enc.EncodeElement("", start)
+	default:
+		return enc.EncodeElement(csvValue(v), start)
+	}
+
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := encodeXMLValue(enc, child.name, child.value); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// writeMoviesNDJSON() writes each movie as compact JSON on its own line
+func writeMoviesNDJSON(w *bufio.Writer, next func() (*data.Movie, bool, error), fields []string) error {
+	for {
+		movie, ok, err := next()
+		if err != nil || !ok {
+			return err
+		}
+
+		projected, err := projectMovie(movie, fields)
+		if err != nil {
+			return err
+		}
+		js, err := json.Marshal(projected)
+		if err != nil {
+			return err
+		}
+		w.Write(js)
+		w.WriteByte('\n')
+	}
+}
+
+// movieJSONFields() returns the movie's JSON encoding decoded into plain values
+// keyed by field name, keeping numbers exactly as they were written
+func movieJSONFields(movie *data.Movie) (map[string]interface{}, error) {
+	js, err := json.Marshal(movie)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+
+	var values map[string]interface{}
+	if err := dec.Decode(&values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// singleMovie() returns a next() function for writeMovies() that yields one movie
+func singleMovie(movie *data.Movie) func() (*data.Movie, bool, error) {
+	done := false
+	return func() (*data.Movie, bool, error) {
+		if done {
+			return nil, false, nil
+		}
+		done = true
+		return movie, true, nil
+	}
+}
+
+// movieSlice() returns a next() function for writeMovies() that yields the movies in turn
+func movieSlice(movies []*data.Movie) func() (*data.Movie, bool, error) {
+	i := 0
+	return func() (*data.Movie, bool, error) {
+		if i == len(movies) {
+			return nil, false, nil
+		}
+		i++
+		return movies[i-1], true, nil
+	}
+}
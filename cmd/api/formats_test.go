@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	app := &application{}
+
+	tests := []struct {
+		name    string
+		url     string
+		accept  string
+		want    string
+		wantErr error
+	}{
+		{"no accept header", "/v1/movies", "", formatJSON, nil},
+		{"blank accept header", "/v1/movies", "  ", formatJSON, nil},
+		{"json", "/v1/movies", "application/json", formatJSON, nil},
+		{"csv", "/v1/movies", "text/csv", formatCSV, nil},
+		{"application xml", "/v1/movies", "application/xml", formatXML, nil},
+		{"text xml", "/v1/movies", "text/xml", formatXML, nil},
+		{"ndjson", "/v1/movies", "application/x-ndjson", formatNDJSON, nil},
+		{"case insensitive", "/v1/movies", "Text/CSV", formatCSV, nil},
+		{"any type", "/v1/movies", "*/*", formatJSON, nil},
+		{"text wildcard", "/v1/movies", "text/*", formatCSV, nil},
+		{"highest q wins", "/v1/movies", "application/json;q=0.5, text/csv;q=0.9", formatCSV, nil},
+		{"ties keep the first range", "/v1/movies", "application/xml, text/csv", formatXML, nil},
+		{"q=0 rules a type out", "/v1/movies", "text/csv;q=0, text/*", formatXML, nil},
+		{"q=0 on everything offered", "/v1/movies", "application/json;q=0, */*;q=0", "", errNotAcceptable},
+		{"params before q", "/v1/movies", "text/csv;charset=utf-8;q=0.8, application/json;q=0.1", formatCSV, nil},
+		{"bad q counts as zero", "/v1/movies", "text/csv;q=high", "", errNotAcceptable},
+		{"unknown type", "/v1/movies", "image/png", "", errNotAcceptable},
+		{"query parameter wins", "/v1/movies?format=xml", "text/csv", formatXML, nil},
+		{"unknown query parameter", "/v1/movies?format=yaml", "", "", errNotAcceptable},
+		{"browser", "/v1/movies", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", formatJSON, nil},
+		{"browser without json", "/v1/movies", "text/html,application/xml;q=0.9,application/json;q=0,*/*;q=0.8", formatXML, nil},
+		{"unoffered favourite without wildcard", "/v1/movies", "text/html, application/xml;q=0.9, application/json;q=0.5", formatXML, nil},
+		{"wildcard rejection", "/v1/movies", "text/*;q=0, */*", formatJSON, nil},
+		{"wildcard rejection leaves other types", "/v1/movies", "text/*;q=0, application/xml", formatXML, nil},
+		{"wildcard rejection covers csv", "/v1/movies", "text/*;q=0, application/json;q=0, */*;q=0.5", formatXML, nil},
+		{"specific range beats rejection", "/v1/movies", "text/*;q=0, text/csv", formatCSV, nil},
+		{"specific rejection beats wildcard", "/v1/movies", "application/json;q=0, */*", formatCSV, nil},
+		{"specific range beats higher wildcard q", "/v1/movies", "*/*, text/csv;q=0.5, application/json;q=0.1", formatXML, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.url, nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+
+			got, err := app.negotiateFormat(r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v; want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMediaRangeMatches(t *testing.T) {
+	tests := []struct {
+		mediaRange string
+		mediaType  string
+		want       bool
+	}{
+		{"*/*", "text/csv", true},
+		{"text/csv", "text/csv", true},
+		{"text/*", "text/csv", true},
+		{"text/*", "application/json", false},
+		{"application/json", "application/xml", false},
+		{"text/c*", "text/csv", false},
+		{"tex/*", "text/csv", false},
+	}
+
+	for _, tt := range tests {
+		if got := mediaRangeMatches(tt.mediaRange, tt.mediaType); got != tt.want {
+			t.Errorf("mediaRangeMatches(%q, %q) = %v; want %v", tt.mediaRange, tt.mediaType, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/julienschmidt/httprouter"
+	"greenlight.alexedwards.net/internal/data"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+// readGenres() reads the ?genres= filter of a listing and resolves the names
+// to slugs, so that filtering by "Sci-Fi" finds movies in "science-fiction"
+func (app *application) readGenres(qs url.Values) ([]string, error) {
+	genres := app.readCSV(qs, "genres", []string{})
+	if len(genres) == 0 {
+		return genres, nil
+	}
+
+	index, err := app.models.Genres.Index()
+	if err != nil || index == nil {
+		return genres, err
+	}
+	return index.ResolveAll(genres), nil
+}
+
+func (app *application) listGenresHandler(w http.ResponseWriter, r *http.Request) {
+	genres, err := app.models.Genres.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"genres": genres}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createGenreHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Slug    string   `json:"slug"`
+		Name    string   `json:"name"`
+		Aliases []string `json:"aliases"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	genre := &data.Genre{
+		Slug:    input.Slug,
+		Name:    input.Name,
+		Aliases: input.Aliases,
+	}
+
+	// the slug is optional and made from the name if left out
+	if genre.Slug == "" {
+		genre.Slug = data.GenreKey(genre.Name)
+	}
+
+	index, err := app.models.Genres.Index()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateGenre(v, genre, index); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Genres.Insert(genre)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/genres/%s", genre.Slug))
+
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"genre": genre}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showGenreHandler(w http.ResponseWriter, r *http.Request) {
+	slug := httprouter.ParamsFromContext(r.Context()).ByName("slug")
+
+	genre, err := app.models.Genres.Get(slug)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"genre": genre}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateGenreHandler changes the display name and aliases of a genre
+func (app *application) updateGenreHandler(w http.ResponseWriter, r *http.Request) {
+	slug := httprouter.ParamsFromContext(r.Context()).ByName("slug")
+
+	genre, err := app.models.Genres.Get(slug)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Name    string   `json:"name"`
+		Aliases []string `json:"aliases"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	genre.Name = input.Name
+	genre.Aliases = input.Aliases
+
+	index, err := app.models.Genres.Index()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateGenre(v, genre, index); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Genres.Update(genre)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"genre": genre}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteGenreHandler removes a genre no movie uses; one in use must be merged
+func (app *application) deleteGenreHandler(w http.ResponseWriter, r *http.Request) {
+	slug := httprouter.ParamsFromContext(r.Context()).ByName("slug")
+
+	err := app.models.Genres.Delete(slug)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGenreInUse):
+			v := validator.New()
+			v.AddError("slug", "is used by movies and must be merged into another genre instead")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "genre successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// mergeGenreHandler folds a duplicate genre into another one: its movies,
+// its slug and its aliases all move to the genre given as "into"
+func (app *application) mergeGenreHandler(w http.ResponseWriter, r *http.Request) {
+	slug := httprouter.ParamsFromContext(r.Context()).ByName("slug")
+
+	var input struct {
+		Into string `json:"into"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Into != "", "into", "must be provided")
+	v.Check(input.Into != slug, "into", "must be a different genre")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	changed, err := app.models.Genres.Merge(slug, input.Into, app.actor(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGenreNotFound):
+			v.AddError("into", "does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	genre, err := app.models.Genres.Get(input.Into)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"genre": genre, "movies_changed": changed}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
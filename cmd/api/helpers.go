@@ -1,14 +1,24 @@
 package main
 
 import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
+	"greenlight.alexedwards.net/internal/data"
+	"greenlight.alexedwards.net/internal/validator"
 )
 
 func (app *application) readIDParam(r *http.Request) (int64, error) {
@@ -20,14 +30,46 @@ func (app *application) readIDParam(r *http.Request) (int64, error) {
 	return id, nil
 }
 
+// maxActorLength limits how much of the X-Actor header is kept in the revision history
+const maxActorLength = 100
+
+// modelsFor() returns the models to use for changes made by a request, so that
+// the revision history knows who made them
+func (app *application) modelsFor(r *http.Request) data.Models {
+	return app.models.WithActor(app.actor(r))
+}
+
+// actor() identifies who is making a request. There are no user accounts yet,
+// so it is the X-Actor header if the client sends one, else its address
+func (app *application) actor(r *http.Request) string {
+	actor := strings.TrimSpace(r.Header.Get("X-Actor"))
+	if len(actor) > maxActorLength {
+		actor = actor[:maxActorLength]
+	}
+	if actor == "" {
+		actor = r.RemoteAddr
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			actor = host
+		}
+	}
+	return actor
+}
+
 // define type for envelope json data
 type envelope map[string]interface{}
 
-func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
-	js, err := json.MarshalIndent(data, "", "\t")
+func (app *application) writeJSON(w http.ResponseWriter, r *http.Request, status int, data envelope, headers http.Header) error {
+	var js []byte
+	var err error
+	if app.prettyJSON(r) {
+		js, err = json.MarshalIndent(data, "", "\t")
+	} else {
+		js, err = json.Marshal(data)
+	}
 	if err != nil {
 		return err
 	}
+	js = append(js, '\n')
 
 	// add any provided headers
 	for k, v := range headers {
@@ -41,6 +83,95 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 	return nil
 }
 
+// prettyJSON() reports whether the JSON should be indented: always in development, otherwise only with ?pretty=true
+func (app *application) prettyJSON(r *http.Request) bool {
+	return app.config.env == "development" || r.URL.Query().Get("pretty") == "true"
+}
+
+// writeJSONStream() writes the envelope like writeJSON(), except that the list
+// under key is not held in memory: next() is called repeatedly to get the next
+// item until it returns false, and each item is encoded and written on its own.
+// Errors from next() can't change the status code any more, so the caller has
+// to abort the response with abortResponse()
+func (app *application) writeJSONStream(w http.ResponseWriter, r *http.Request, status int, data envelope, key string, next func() (interface{}, bool, error), headers http.Header) error {
+	pretty := app.prettyJSON(r)
+
+	// encode the other envelope values up front so we can still fail cleanly
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	values := make([][]byte, len(keys))
+	for i, k := range keys {
+		js, err := app.encodeJSONValue(data[k], pretty, "\t")
+		if err != nil {
+			return err
+		}
+		values[i] = js
+	}
+
+	for k, v := range headers {
+		w.Header()[k] = v
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	// the same layout as json.MarshalIndent() when pretty, compact otherwise
+	open, sep, colon, itemIndent, closeList, end := "{", ",", ":", "", "]", "}\n"
+	if pretty {
+		open, sep, colon, itemIndent, closeList, end = "{\n\t", ",\n\t", ": ", "\n\t\t", "\n\t]", "\n}\n"
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(open)
+	for i, k := range keys {
+		fmt.Fprintf(bw, "%q%s%s%s", k, colon, values[i], sep)
+	}
+	fmt.Fprintf(bw, "%q%s[", key, colon)
+
+	count := 0
+	for {
+		item, ok, err := next()
+		if err != nil {
+			bw.Flush()
+			return err
+		}
+		if !ok {
+			break
+		}
+
+		js, err := app.encodeJSONValue(item, pretty, "\t\t")
+		if err != nil {
+			bw.Flush()
+			return err
+		}
+		if count > 0 {
+			bw.WriteString(",")
+		}
+		bw.WriteString(itemIndent)
+		bw.Write(js)
+		count++
+	}
+
+	// an empty list is written as [] in both layouts
+	if count > 0 {
+		bw.WriteString(closeList)
+	} else {
+		bw.WriteString("]")
+	}
+	bw.WriteString(end)
+	return bw.Flush()
+}
+
+// encodeJSONValue() marshals a single value, indenting it relative to prefix when pretty is set
+func (app *application) encodeJSONValue(v interface{}, pretty bool, prefix string) ([]byte, error) {
+	if pretty {
+		return json.MarshalIndent(v, prefix, "\t")
+	}
+	return json.Marshal(v)
+}
+
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
 
 	// limit request body size to 1mb
@@ -95,3 +226,131 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 	}
 	return nil
 }
+
+// readString() returns a string value from the query string, or the default value if the key is missing
+func (app *application) readString(qs url.Values, key string, defaultValue string) string {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	return s
+}
+
+// readInt() converts a query string value to an int, recording an error in the validator if it isn't one
+func (app *application) readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		v.AddError(key, "must be an integer value")
+		return defaultValue
+	}
+	return i
+}
+
+// readCSV() splits a comma-separated query string value into a slice, or returns the default value if the key is missing
+func (app *application) readCSV(qs url.Values, key string, defaultValue []string) []string {
+	csv := qs.Get(key)
+	if csv == "" {
+		return defaultValue
+	}
+	return strings.Split(csv, ",")
+}
+
+// error returned when a cursor has been tampered with or can't be decoded
+var errInvalidCursor = errors.New("invalid cursor")
+
+// encodeCursor() turns a cursor into an opaque "<payload>.<signature>" string
+func (app *application) encodeCursor(cursor *data.Cursor) (string, error) {
+	js, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(js)
+	return payload + "." + app.signCursor(payload), nil
+}
+
+// decodeCursor() checks the signature of an opaque cursor and decodes it
+func (app *application) decodeCursor(s string) (*data.Cursor, error) {
+	payload, signature, ok := strings.Cut(s, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(app.signCursor(payload))) {
+		return nil, errInvalidCursor
+	}
+
+	js, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	var cursor data.Cursor
+	if err := json.Unmarshal(js, &cursor); err != nil {
+		return nil, errInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// signCursor() returns the base64 HMAC-SHA256 of a cursor payload
+func (app *application) signCursor(payload string) string {
+	mac := hmac.New(sha256.New, []byte(app.config.cursor.secret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// readCursor() decodes the cursor query parameter, which must be one for the
+// given sort. It returns nil for the first page, and records an error in v if
+// the cursor is invalid
+func (app *application) readCursor(qs url.Values, sort string, v *validator.Validator) *data.Cursor {
+	s := app.readString(qs, "cursor", "")
+	if s == "" {
+		return nil
+	}
+	cursor, err := app.decodeCursor(s)
+	if err != nil || cursor.Sort != sort {
+		v.AddError("cursor", "is invalid")
+		return nil
+	}
+	return cursor
+}
+
+// paginationLinks() encodes the next/prev cursors of a listing and builds the
+// metadata envelope along with a Link header pointing at the neighbouring pages
+func (app *application) paginationLinks(r *http.Request, metadata data.Metadata) (envelope, http.Header, error) {
+	env := envelope{"page_size": metadata.PageSize}
+	headers := make(http.Header)
+
+	var links []string
+	pages := []struct {
+		rel    string
+		cursor *data.Cursor
+	}{
+		{"next", metadata.NextCursor},
+		{"prev", metadata.PrevCursor},
+	}
+	for _, page := range pages {
+		if page.cursor == nil {
+			continue
+		}
+		encoded, err := app.encodeCursor(page.cursor)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// keep the other query parameters and only swap the cursor
+		u := *r.URL
+		qs := u.Query()
+		qs.Set("cursor", encoded)
+		u.RawQuery = qs.Encode()
+
+		env[page.rel+"_cursor"] = encoded
+		env[page.rel] = u.String()
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, u.String(), page.rel))
+	}
+
+	if len(links) > 0 {
+		headers.Set("Link", strings.Join(links, ", "))
+	}
+	return env, headers, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"greenlight.alexedwards.net/internal/data"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	app := &application{}
+	app.config.cursor.secret = "test-secret"
+
+	tests := []struct {
+		name   string
+		cursor data.Cursor
+	}{
+		{"forward", data.Cursor{Sort: "title", Value: "Moana", ID: 42}},
+		{"backward", data.Cursor{Sort: "-year", Value: "2016", ID: 7, Backward: true}},
+		{"empty value", data.Cursor{Sort: "id", ID: 1}},
+		{"dots and unicode", data.Cursor{Sort: "title", Value: "Amélie. Le fabuleux destin", ID: 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := app.encodeCursor(&tt.cursor)
+			if err != nil {
+				t.Fatalf("encodeCursor: %v", err)
+			}
+			got, err := app.decodeCursor(s)
+			if err != nil {
+				t.Fatalf("decodeCursor(%q): %v", s, err)
+			}
+			if *got != tt.cursor {
+				t.Errorf("got %+v; want %+v", *got, tt.cursor)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorRejectsTampering(t *testing.T) {
+	app := &application{}
+	app.config.cursor.secret = "test-secret"
+
+	valid, err := app.encodeCursor(&data.Cursor{Sort: "title", Value: "Moana", ID: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, signature, _ := strings.Cut(valid, ".")
+
+	other := &application{}
+	other.config.cursor.secret = "another-secret"
+	foreign, err := other.encodeCursor(&data.Cursor{Sort: "title", Value: "Moana", ID: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forged, err := app.encodeCursor(&data.Cursor{Sort: "title", Value: "Moana", ID: 43})
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"empty", ""},
+		{"no signature", payload},
+		{"empty signature", payload + "."},
+		{"changed payload", forgedPayload + "." + signature},
+		{"signed with another secret", foreign},
+		{"not base64", "!!!." + app.signCursor("!!!")},
+		{"not json", "bm90IGpzb24." + app.signCursor("bm90IGpzb24")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor, err := app.decodeCursor(tt.cursor)
+			if !errors.Is(err, errInvalidCursor) {
+				t.Errorf("got %+v, %v; want errInvalidCursor", cursor, err)
+			}
+		})
+	}
+}
+
+func TestReadCursor(t *testing.T) {
+	app := &application{}
+	app.config.cursor.secret = "test-secret"
+
+	encode := func(cursor data.Cursor) string {
+		s, err := app.encodeCursor(&cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name    string
+		query   url.Values
+		want    *data.Cursor
+		wantErr bool
+	}{
+		{"first page", url.Values{}, nil, false},
+		{"matching sort", url.Values{"cursor": {encode(data.Cursor{Sort: "name", Value: "Ada", ID: 3})}}, &data.Cursor{Sort: "name", Value: "Ada", ID: 3}, false},
+		{"other sort", url.Values{"cursor": {encode(data.Cursor{Sort: "-deleted_at", ID: 3})}}, nil, true},
+		{"tampered", url.Values{"cursor": {"abc.def"}}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			got := app.readCursor(tt.query, "name", v)
+			if _, hasErr := v.Errors["cursor"]; hasErr != tt.wantErr {
+				t.Errorf("got errors %v; want a cursor error: %v", v.Errors, tt.wantErr)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("got %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"greenlight.alexedwards.net/internal/data"
+)
+
+// maxIdempotencyKeyLength limits the Idempotency-Key header to something sensible
+const maxIdempotencyKeyLength = 255
+
+// maxIdempotentBodyBytes is the largest body any endpoint taking an
+// Idempotency-Key accepts, an import or an image upload
+const maxIdempotentBodyBytes = max(maxImportBytes, maxImageBytes+maxImageFormBytes)
+
+// idempotent() makes a non-idempotent handler safe to retry. A request with an
+// Idempotency-Key header runs once; repeats with the same key and body get the
+// stored response back, while reusing the key for a different request is a 422.
+// Keys belong to the caller, so two callers picking the same key never see each
+// other's responses. Requests without the header are passed straight through
+func (app *application) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			app.badRequestResponse(w, r, fmt.Errorf("Idempotency-Key header must not be more than %d bytes long", maxIdempotencyKeyLength))
+			return
+		}
+
+		// the body is needed for the fingerprint, then put back for the handler
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodyBytes))
+		if err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", maxIdempotentBodyBytes))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// the same key on another endpoint counts as a different request
+		hash := sha256.New()
+		fmt.Fprintf(hash, "%s %s\n", r.Method, r.URL.RequestURI())
+		hash.Write(body)
+		fingerprint := hash.Sum(nil)
+
+		key = app.idempotencyKey(r, key)
+		stored, err := app.models.IdempotencyKeys.Reserve(key, fingerprint, app.config.idempotency.ttl, app.config.idempotency.lease)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrIdempotencyKeyMismatch):
+				app.idempotencyKeyMismatchResponse(w, r)
+			case errors.Is(err, data.ErrIdempotencyKeyInProgress):
+				app.idempotencyKeyInProgressResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		// a completed request is answered from the stored response
+		if stored != nil {
+			for k, v := range stored.Headers {
+				w.Header()[k] = v
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.Status)
+			w.Write(stored.Body)
+			return
+		}
+
+		// Unless a response is stored the key is freed, so the client can retry
+		// with it. That covers server errors, which aren't stored, a response
+		// that couldn't be stored and a handler that panicked, as deferred calls
+		// run while a panic unwinds
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			if err := app.models.IdempotencyKeys.Release(key); err != nil {
+				app.logError(r, err)
+			}
+		}()
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+
+		if rec.status >= http.StatusInternalServerError {
+			return
+		}
+
+		response := &data.StoredResponse{
+			Status:  rec.status,
+			Headers: rec.headers,
+			Body:    rec.body.Bytes(),
+		}
+		if err := app.models.IdempotencyKeys.Complete(key, response); err != nil {
+			app.logError(r, err)
+			return
+		}
+		completed = true
+	}
+}
+
+// responseRecorder passes a response through to the client while keeping a
+// copy of the status, the headers set by the handler and the body
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	headers     http.Header
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.wroteHeader {
+		return
+	}
+	rec.status = status
+	rec.wroteHeader = true
+
+	// headers added by middleware further out are added again on replay
+	rec.headers = rec.ResponseWriter.Header().Clone()
+	for _, name := range []string{"Vary", "Content-Encoding", "Content-Length"} {
+		rec.headers.Del(name)
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// Unwrap() gives http.ResponseController access to the underlying writer
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// idempotencyKey() returns the key a request's Idempotency-Key is stored
+// under: a hash of the key with who is calling, meaning their owner token if
+// they sent one and app.actor() otherwise. Hashing keeps tokens out of the table
+func (app *application) idempotencyKey(r *http.Request, key string) string {
+	caller := "actor " + app.actor(r)
+	if owner, err := app.listOwner(r); err == nil && owner != "" {
+		caller = "owner " + owner
+	}
+	sum := sha256.Sum256([]byte(caller + "\n" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// purgeIdempotencyKeys() deletes expired idempotency keys every interval; it runs for the lifetime of the server
+func (app *application) purgeIdempotencyKeys(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		n, err := app.models.IdempotencyKeys.DeleteExpired()
+		if err != nil {
+			app.logger.Println(err)
+			continue
+		}
+		if n > 0 {
+			app.logger.Printf("deleted %d expired idempotency keys", n)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"greenlight.alexedwards.net/internal/data"
+)
+
+func TestIdempotencyKeyIsScopedToTheCaller(t *testing.T) {
+	app := &application{}
+	token, _, err := data.NewOwnerToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherToken, _, err := data.NewOwnerToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(remoteAddr, actor, token string) string {
+		r := httptest.NewRequest("POST", "/v1/lists", nil)
+		r.RemoteAddr = remoteAddr
+		if actor != "" {
+			r.Header.Set("X-Actor", actor)
+		}
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		return app.idempotencyKey(r, "retry-1")
+	}
+
+	tests := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{"same address", request("192.0.2.1:1234", "", ""), request("192.0.2.1:5678", "", ""), true},
+		{"different addresses", request("192.0.2.1:1234", "", ""), request("192.0.2.2:1234", "", ""), false},
+		{"different actors", request("192.0.2.1:1234", "alice", ""), request("192.0.2.1:1234", "bob", ""), false},
+		{"same owner from anywhere", request("192.0.2.1:1234", "alice", token), request("192.0.2.2:1234", "bob", token), true},
+		{"different owners", request("192.0.2.1:1234", "", token), request("192.0.2.1:1234", "", otherToken), false},
+		{"owner and anonymous", request("192.0.2.1:1234", "", token), request("192.0.2.1:1234", "", ""), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if (tt.a == tt.b) != tt.same {
+				t.Errorf("keys %q and %q: same = %v; want %v", tt.a, tt.b, tt.a == tt.b, tt.same)
+			}
+		})
+	}
+}
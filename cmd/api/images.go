@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"greenlight.alexedwards.net/internal/data"
+	"greenlight.alexedwards.net/internal/storage"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+// maxImageBytes limits the size of an uploaded image to 10MB
+const maxImageBytes = 10 << 20
+
+// maxImageFormBytes is the room the rest of an upload's form gets on top of the image
+const maxImageFormBytes = 1 << 20
+
+// imageCacheControl lets clients and caches keep image files for good, since
+// a file's name changes whenever its contents would
+const imageCacheControl = "public, max-age=31536000, immutable"
+
+// imageNameRX matches the names image files and their thumbnails are served under
+var imageNameRX = regexp.MustCompile(`^[0-9a-f]{64}(-w[0-9]+)?\.(jpg|png|gif)$`)
+
+// setImageFiles() fills in the URLs of an image's file and its thumbnails
+func setImageFiles(img *data.Image) {
+	img.Files = map[string]string{"original": "/v1/images/" + img.FileName()}
+	for _, width := range img.Thumbnails {
+		img.Files[fmt.Sprintf("w%d", width)] = "/v1/images/" + img.ThumbnailName(width)
+	}
+}
+
+// removeImageFiles() deletes the files of an image no movie uses any more
+func (app *application) removeImageFiles(img *data.Image) error {
+	for _, name := range img.FileNames() {
+		if err := app.storage.Delete(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uploadImageHandler takes a multipart/form-data upload with the file in the
+// "image" field and optionally what it shows in "kind" (a poster by default).
+// The type is worked out from the file's contents, not from what the client
+// says it is, and thumbnails are made for the widths it is wider than. A retry
+// with the same Idempotency-Key must send the same body, multipart boundary
+// included, to get the first response back
+func (app *application) uploadImageHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// don't bother reading the upload for a movie that isn't there
+	_, err = app.models.Movies.Get(movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "multipart/form-data" {
+		app.unsupportedMediaTypeResponse(w, r)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageBytes+maxImageFormBytes)
+	err = r.ParseMultipartForm(maxImageFormBytes)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			err = fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		}
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	v := validator.New()
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		if errors.Is(err, http.ErrMissingFile) {
+			v.AddError("image", "must be provided")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(io.LimitReader(file, maxImageBytes+1))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	v.Check(len(content) > 0, "image", "must not be empty")
+	v.Check(len(content) <= maxImageBytes, "image", fmt.Sprintf("must not be larger than %d bytes", maxImageBytes))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	img := &data.Image{
+		MovieID:     movieID,
+		Kind:        r.FormValue("kind"),
+		ContentType: http.DetectContentType(content),
+		Size:        int64(len(content)),
+	}
+	if img.Kind == "" {
+		img.Kind = "poster"
+	}
+
+	// the dimensions are checked before decoding, so a huge image is never decoded
+	if _, ok := data.ImageTypes[img.ContentType]; ok {
+		config, _, err := image.DecodeConfig(bytes.NewReader(content))
+		if err != nil {
+			v.AddError("image", "could not be read as an image")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		img.Width, img.Height = int32(config.Width), int32(config.Height)
+	}
+	if data.ValidateImage(v, img); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// decoding takes memory for the whole image, so wait for a free slot
+	select {
+	case app.imageDecodes <- struct{}{}:
+		defer func() { <-app.imageDecodes }()
+	case <-r.Context().Done():
+		return
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		v.AddError("image", "could not be read as an image")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	sum := sha256.Sum256(content)
+	img.Hash = hex.EncodeToString(sum[:])
+
+	// the thumbnails are made before the row is locked, as that takes a while
+	thumbnails := make(map[int32][]byte)
+	for _, width := range thumbnailWidths {
+		if width >= img.Width {
+			continue
+		}
+		thumbnails[width], err = encodeThumbnail(decoded, int(width), img.ThumbnailType())
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		img.Thumbnails = append(img.Thumbnails, width)
+	}
+
+	err = app.models.Images.Insert(img, func() error {
+		for _, width := range img.Thumbnails {
+			err := app.storage.Put(img.ThumbnailName(width), bytes.NewReader(thumbnails[width]), img.ThumbnailType())
+			if err != nil {
+				return err
+			}
+		}
+		return app.storage.Put(img.FileName(), bytes.NewReader(content), img.ContentType)
+	})
+	if err != nil {
+		// files written before the row failed to go in would be left unused
+		if err := app.models.Images.RemoveUnused([]*data.Image{img}, app.removeImageFiles); err != nil {
+			app.logError(r, err)
+		}
+
+		switch {
+		case errors.Is(err, data.ErrDuplicateImage):
+			v.AddError("image", "the movie already has this image")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	setImageFiles(img)
+
+	headers := make(http.Header)
+	headers.Set("Location", img.Files["original"])
+
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"image": img}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listImagesHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Movies.Get(movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	images, err := app.models.Images.GetAll(movieID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	for _, img := range images {
+		setImageFiles(img)
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"images": images}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteImageHandler removes an image from a movie. Its files are deleted
+// too, unless another movie has the same image
+func (app *application) deleteImageHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	id, err := strconv.ParseInt(httprouter.ParamsFromContext(r.Context()).ByName("image_id"), 10, 64)
+	if err != nil || id < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	img, err := app.models.Images.Delete(movieID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// the image is gone either way, so failing to tidy up its files is only logged
+	if err := app.models.Images.RemoveUnused([]*data.Image{img}, app.removeImageFiles); err != nil {
+		app.logError(r, err)
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "image successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// serveImageHandler sends an image file or thumbnail. The name says what is
+// in the file, so it doubles as the ETag and the file can be cached for good
+func (app *application) serveImageHandler(w http.ResponseWriter, r *http.Request) {
+	name := httprouter.ParamsFromContext(r.Context()).ByName("name")
+	if !imageNameRX.MatchString(name) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	etag := strconv.Quote(name)
+	w.Header().Set("Cache-Control", imageCacheControl)
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	file, object, err := app.storage.Get(name)
+	if err != nil {
+		w.Header().Del("Cache-Control")
+		w.Header().Del("ETag")
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", object.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(object.Size, 10))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := io.Copy(w, file); err != nil {
+		app.logError(r, err)
+	}
+}
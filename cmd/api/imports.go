@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"greenlight.alexedwards.net/internal/data"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+// maxImportBytes limits the size of an import upload to 10MB
+const maxImportBytes = 10 << 20
+
+// importRowError is the report entry for a row that could not be imported.
+// Row is the line number in the uploaded file (so the CSV header is row 1)
+type importRowError struct {
+	Row    int               `json:"row"`
+	Errors map[string]string `json:"errors"`
+}
+
+// importRow is one parsed row of an upload, with any parse errors already recorded in v
+type importRow struct {
+	line      int
+	movie     *data.Movie
+	v         *validator.Validator
+	malformed bool // the row couldn't be decoded at all, so there is nothing to validate
+}
+
+func (app *application) importMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	dryRun := app.readString(r.URL.Query(), "dry_run", "false")
+	v.Check(validator.In(dryRun, "true", "false"), "dry_run", "must be true or false")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// the upload format comes from the Content-Type of the body
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	var rows []importRow
+	var err error
+	switch mediaType {
+	case "text/csv":
+		rows, err = readImportCSV(r.Body)
+	case "application/x-ndjson":
+		rows, err = readImportNDJSON(r.Body)
+	default:
+		app.unsupportedMediaTypeResponse(w, r)
+		return
+	}
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			err = fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		}
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if len(rows) == 0 {
+		app.badRequestResponse(w, r, errors.New("body must contain at least one movie"))
+		return
+	}
+
+	genres, err := app.models.Genres.Index()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// run every row through the same rules as createMovieHandler
+	valid := []*data.Movie{}
+	failed := []importRowError{}
+	for _, row := range rows {
+		if !row.malformed {
+			data.ValidateMovie(row.v, row.movie, genres)
+		}
+		if !row.v.Valid() {
+			failed = append(failed, importRowError{Row: row.line, Errors: row.v.Errors})
+			continue
+		}
+		valid = append(valid, row.movie)
+	}
+
+	imported := 0
+	if dryRun == "false" && len(valid) > 0 {
+		err = app.modelsFor(r).Movies.InsertMany(valid)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDuplicateExternalID):
+				// the rows go in all at once, so one taken id stops the whole import
+				app.failedValidationResponse(w, r, map[string]string{"external_ids": err.Error()})
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		imported = len(valid)
+	}
+
+	report := envelope{
+		"dry_run":  dryRun == "true",
+		"total":    len(rows),
+		"valid":    len(valid),
+		"imported": imported,
+		"failed":   len(failed),
+		"errors":   failed,
+	}
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"import": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readImportCSV() parses a CSV upload. The first row names the columns: title,
+// year, runtime and genres are required, id, version and the rating columns (as
+// written by a CSV export) are ignored. Genres are separated by csvListSeparator
+// and runtime uses the same "<number> mins" form as everywhere else
+func readImportCSV(body io.Reader) ([]importRow, error) {
+	cr := csv.NewReader(body)
+	cr.ReuseRecord = true
+	// rows with the wrong number of fields are reported per row below
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("body must not be empty")
+		}
+		return nil, err
+	}
+
+	// the header's slice is reused for the rows that follow, so keep its length
+	fields := len(header)
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !validator.In(name, "title", "year", "runtime", "genres", "external_ids", "id", "version", "average_rating", "rating_count") {
+			return nil, fmt.Errorf("header contains unknown column %q", name)
+		}
+		columns[name] = i
+	}
+	for _, name := range []string{"title", "year", "runtime", "genres"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("header must contain a %q column", name)
+		}
+	}
+
+	var rows []importRow
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+
+		row := importRow{line: line, movie: &data.Movie{}, v: validator.New()}
+		if len(record) != fields {
+			row.v.AddError("row", fmt.Sprintf("must have %d fields like the header, not %d", fields, len(record)))
+			row.malformed = true
+			rows = append(rows, row)
+			continue
+		}
+		row.movie.Title = record[columns["title"]]
+
+		if year := record[columns["year"]]; year != "" {
+			i, err := strconv.ParseInt(year, 10, 32)
+			row.v.Check(err == nil, "year", "must be an integer value")
+			row.movie.Year = int32(i)
+		}
+
+		if runtime := record[columns["runtime"]]; runtime != "" {
+			err := row.movie.Runtime.UnmarshalText([]byte(runtime))
+			row.v.Check(err == nil, "runtime", data.ErrInvalidRuntimeFormat.Error())
+		}
+
+		if genres := record[columns["genres"]]; genres != "" {
+			row.movie.Genres = strings.Split(genres, csvListSeparator)
+		}
+
+		if i, ok := columns["external_ids"]; ok && record[i] != "" {
+			err := json.Unmarshal([]byte(record[i]), &row.movie.ExternalIDs)
+			row.v.Check(err == nil, "external_ids", "must be a JSON object of ids by source")
+		}
+
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// readImportNDJSON() parses an upload with one JSON movie per line, in the same
+// shape as the body of POST /v1/movies (id, version and the ratings of an export
+// are accepted and ignored)
+func readImportNDJSON(body io.Reader) ([]importRow, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), maxImportBytes)
+
+	var rows []importRow
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		var input struct {
+			ID      int64        `json:"id"`
+			Title   string       `json:"title"`
+			Year    int32        `json:"year"`
+			Runtime data.Runtime `json:"runtime"`
+			Genres  []string     `json:"genres"`
+			Version int32        `json:"version"`
+
+			ExternalIDs data.ExternalIDs `json:"external_ids"`
+
+			AverageRating *float64 `json:"average_rating"`
+			RatingCount   int32    `json:"rating_count"`
+		}
+
+		row := importRow{line: line, v: validator.New()}
+		dec := json.NewDecoder(bytes.NewReader(text))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&input); err != nil {
+			// a broken line is reported against that row rather than failing the import
+			row.v.AddError("json", ndjsonErrorMessage(err))
+			row.malformed = true
+		}
+
+		row.movie = &data.Movie{
+			Title:   input.Title,
+			Year:    input.Year,
+			Runtime: input.Runtime,
+			Genres:  input.Genres,
+
+			ExternalIDs: input.ExternalIDs,
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// ndjsonErrorMessage() describes why a single NDJSON line couldn't be decoded
+func ndjsonErrorMessage(err error) string {
+	var syntaxError *json.SyntaxError
+	var unmarshalTypeError *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &syntaxError):
+		return fmt.Sprintf("badly-formed JSON (at character %d)", syntaxError.Offset)
+	case errors.As(err, &unmarshalTypeError) && unmarshalTypeError.Field != "":
+		return fmt.Sprintf("incorrect JSON type for field %q", unmarshalTypeError.Field)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return "badly-formed JSON"
+	default:
+		return err.Error()
+	}
+}
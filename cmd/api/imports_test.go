@@ -0,0 +1,156 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"greenlight.alexedwards.net/internal/data"
+)
+
+func TestReadImportCSV(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		wantErr       string
+		wantMovies    []data.Movie
+		wantRowErrors []map[string]bool
+	}{
+		{
+			name: "rows",
+			body: "title,year,runtime,genres\nMoana,2016,107 mins,animation|adventure\nBlack Panther,2018,134 mins,action\n",
+			wantMovies: []data.Movie{
+				{Title: "Moana", Year: 2016, Runtime: 107, Genres: []string{"animation", "adventure"}},
+				{Title: "Black Panther", Year: 2018, Runtime: 134, Genres: []string{"action"}},
+			},
+			wantRowErrors: []map[string]bool{{}, {}},
+		},
+		{
+			name: "export columns ignored, header case and order free",
+			body: "ID, Version,Genres,Title,Runtime,Year,average_rating,rating_count\n7,3,drama,Casablanca,102 mins,1942,4.5,10\n",
+			wantMovies: []data.Movie{
+				{Title: "Casablanca", Year: 1942, Runtime: 102, Genres: []string{"drama"}},
+			},
+			wantRowErrors: []map[string]bool{{}},
+		},
+		{
+			name: "external ids",
+			body: "title,year,runtime,genres,external_ids\nMoana,2016,107 mins,animation,\"{\"\"imdb\"\": \"\"tt3521164\"\"}\"\n",
+			wantMovies: []data.Movie{
+				{Title: "Moana", Year: 2016, Runtime: 107, Genres: []string{"animation"}, ExternalIDs: data.ExternalIDs{"imdb": "tt3521164"}},
+			},
+			wantRowErrors: []map[string]bool{{}},
+		},
+		{
+			name:          "bad values reported per row",
+			body:          "title,year,runtime,genres,external_ids\nMoana,twenty,107 minutes,animation,[]\n",
+			wantMovies:    []data.Movie{{Title: "Moana", Genres: []string{"animation"}}},
+			wantRowErrors: []map[string]bool{{"year": true, "runtime": true, "external_ids": true}},
+		},
+		{
+			name:          "wrong number of fields reported per row",
+			body:          "title,year,runtime,genres\nMoana,2016\nBlack Panther,2018,134 mins,action,extra\nUp,2009,96 mins,animation\n",
+			wantMovies:    []data.Movie{{}, {}, {Title: "Up", Year: 2009, Runtime: 96, Genres: []string{"animation"}}},
+			wantRowErrors: []map[string]bool{{"row": true}, {"row": true}, {}},
+		},
+		{name: "empty body", body: "", wantErr: "body must not be empty"},
+		{name: "unknown column", body: "title,year,runtime,genres,director\n", wantErr: `header contains unknown column "director"`},
+		{name: "missing column", body: "title,year,runtime\n", wantErr: `header must contain a "genres" column`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := readImportCSV(strings.NewReader(tt.body))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("got error %v; want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkImportRows(t, rows, tt.wantMovies, tt.wantRowErrors)
+		})
+	}
+}
+
+func TestReadImportNDJSON(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		wantMovies    []data.Movie
+		wantRowErrors []map[string]bool
+		wantLines     []int
+	}{
+		{
+			name: "rows",
+			body: `{"title": "Moana", "year": 2016, "runtime": "107 mins", "genres": ["animation"]}` + "\n" +
+				`{"id": 7, "version": 3, "title": "Up", "year": 2009, "runtime": "96 mins", "genres": ["animation"], "average_rating": 4.5, "rating_count": 2}`,
+			wantMovies: []data.Movie{
+				{Title: "Moana", Year: 2016, Runtime: 107, Genres: []string{"animation"}},
+				{Title: "Up", Year: 2009, Runtime: 96, Genres: []string{"animation"}},
+			},
+			wantRowErrors: []map[string]bool{{}, {}},
+			wantLines:     []int{1, 2},
+		},
+		{
+			name:          "blank lines skipped but counted",
+			body:          "\n  \n" + `{"title": "Moana"}` + "\n\n",
+			wantMovies:    []data.Movie{{Title: "Moana"}},
+			wantRowErrors: []map[string]bool{{}},
+			wantLines:     []int{3},
+		},
+		{
+			name:          "broken lines reported per row",
+			body:          `{"title": "Moana"` + "\n" + `{"title": "Up", "director": "Pete Docter"}` + "\n" + `{"title": "Coco"}`,
+			wantMovies:    []data.Movie{{}, {Title: "Up"}, {Title: "Coco"}},
+			wantRowErrors: []map[string]bool{{"json": true}, {"json": true}, {}},
+			wantLines:     []int{1, 2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := readImportNDJSON(strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkImportRows(t, rows, tt.wantMovies, tt.wantRowErrors)
+			for i, row := range rows {
+				if i < len(tt.wantLines) && row.line != tt.wantLines[i] {
+					t.Errorf("row %d is on line %d; want %d", i, row.line, tt.wantLines[i])
+				}
+			}
+		})
+	}
+}
+
+// checkImportRows() compares parsed rows with the movies and the keys of the
+// errors they should have
+func checkImportRows(t *testing.T, rows []importRow, movies []data.Movie, rowErrors []map[string]bool) {
+	t.Helper()
+	if len(rows) != len(movies) {
+		t.Fatalf("got %d rows; want %d", len(rows), len(movies))
+	}
+	for i, row := range rows {
+		got, want := row.movie, movies[i]
+		if got.Title != want.Title || got.Year != want.Year || got.Runtime != want.Runtime ||
+			!slices.Equal(got.Genres, want.Genres) || len(got.ExternalIDs) != len(want.ExternalIDs) {
+			t.Errorf("row %d: got %+v; want %+v", i, *got, want)
+		}
+		for source, id := range want.ExternalIDs {
+			if got.ExternalIDs[source] != id {
+				t.Errorf("row %d: %s id = %q; want %q", i, source, got.ExternalIDs[source], id)
+			}
+		}
+		for key := range rowErrors[i] {
+			if _, ok := row.v.Errors[key]; !ok {
+				t.Errorf("row %d: no error for %q; got %v", i, key, row.v.Errors)
+			}
+		}
+		if len(row.v.Errors) != len(rowErrors[i]) {
+			t.Errorf("row %d: got errors %v; want them for %v", i, row.v.Errors, rowErrors[i])
+		}
+	}
+}
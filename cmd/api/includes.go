@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+
+	"greenlight.alexedwards.net/internal/data"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+// includeLoader fetches a related resource for a batch of movies in one go and
+// returns it keyed by movie id
+type includeLoader func(ids []int64) (map[int64]interface{}, error)
+
+// movieIncludes() returns the related resources that can be embedded in movie
+// responses with ?include=, keyed by the name used in the query string
+func (app *application) movieIncludes() map[string]includeLoader {
+	return map[string]includeLoader{
+		"similar_titles": func(ids []int64) (map[int64]interface{}, error) {
+			matches, err := app.models.Movies.SimilarTitlesFor(ids, 3)
+			if err != nil {
+				return nil, err
+			}
+			related := make(map[int64]interface{}, len(ids))
+			for _, id := range ids {
+				// always embed an array, even if nothing was found
+				if matches[id] == nil {
+					related[id] = []*data.TitleMatch{}
+					continue
+				}
+				related[id] = matches[id]
+			}
+			return related, nil
+		},
+		"credits": func(ids []int64) (map[int64]interface{}, error) {
+			credits, err := app.models.People.CreditsFor(ids)
+			if err != nil {
+				return nil, err
+			}
+			related := make(map[int64]interface{}, len(ids))
+			for _, id := range ids {
+				if credits[id] == nil {
+					related[id] = []*data.Credit{}
+					continue
+				}
+				related[id] = credits[id]
+			}
+			return related, nil
+		},
+		"releases": func(ids []int64) (map[int64]interface{}, error) {
+			releases, err := app.models.Releases.ReleasesFor(ids)
+			if err != nil {
+				return nil, err
+			}
+			related := make(map[int64]interface{}, len(ids))
+			for _, id := range ids {
+				if releases[id] == nil {
+					related[id] = []*data.Release{}
+					continue
+				}
+				related[id] = releases[id]
+			}
+			return related, nil
+		},
+	}
+}
+
+// readShape() reads the ?fields= and ?include= query string values and checks them against the allowlists
+func (app *application) readShape(qs url.Values, v *validator.Validator) (fields, includes []string) {
+	fields = app.readCSV(qs, "fields", nil)
+	includes = app.readCSV(qs, "include", nil)
+
+	data.ValidateFields(v, "fields", fields, data.MovieFieldSafelist)
+
+	loaders := app.movieIncludes()
+	names := make([]string, 0, len(loaders))
+	for name := range loaders {
+		names = append(names, name)
+	}
+	data.ValidateFields(v, "include", includes, names)
+
+	return fields, includes
+}
+
+// shapeMovies() keeps only the requested fields of each movie and embeds the
+// requested related resources. When neither was asked for the movies are
+// returned untouched so they encode exactly as before
+func (app *application) shapeMovies(movies []*data.Movie, fields, includes []string) (interface{}, error) {
+	if len(fields) == 0 && len(includes) == 0 {
+		return movies, nil
+	}
+
+	ids := make([]int64, len(movies))
+	shaped := make([]map[string]interface{}, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+		m, err := projectMovie(movie, fields)
+		if err != nil {
+			return nil, err
+		}
+		shaped[i] = m
+	}
+
+	// each include is loaded for the whole batch with a single call
+	loaders := app.movieIncludes()
+	for _, name := range includes {
+		related, err := loaders[name](ids)
+		if err != nil {
+			return nil, err
+		}
+		for i, id := range ids {
+			shaped[i][name] = related[id]
+		}
+	}
+
+	return shaped, nil
+}
+
+// shapeMovie() is shapeMovies() for a single movie
+func (app *application) shapeMovie(movie *data.Movie, fields, includes []string) (interface{}, error) {
+	shaped, err := app.shapeMovies([]*data.Movie{movie}, fields, includes)
+	if err != nil {
+		return nil, err
+	}
+	if list, ok := shaped.([]map[string]interface{}); ok {
+		return list[0], nil
+	}
+	return movie, nil
+}
+
+// projectMovie() encodes the movie as usual and keeps only the requested fields
+// (all of them if fields is empty), so custom encodings such as Runtime still apply
+func projectMovie(movie *data.Movie, fields []string) (map[string]interface{}, error) {
+	js, err := json.Marshal(movie)
+	if err != nil {
+		return nil, err
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(js, &all); err != nil {
+		return nil, err
+	}
+
+	projected := make(map[string]interface{}, len(all))
+	for key, value := range all {
+		if len(fields) == 0 || validator.In(key, fields...) {
+			projected[key] = value
+		}
+	}
+	return projected, nil
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"greenlight.alexedwards.net/internal/data"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+// Lists belong to the owner token sent as "Authorization: Bearer <token>",
+// which creating a list without one hands out. Private lists only exist for
+// their owner; public ones can be read by anyone using either their id or
+// their slug
+
+// error returned when the Authorization header doesn't hold an owner token
+var errInvalidOwnerToken = errors.New("invalid owner token")
+
+// listOwner() returns the owner of the request's token, or "" if it sent none
+func (app *application) listOwner(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", nil
+	}
+
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return "", errInvalidOwnerToken
+	}
+	v := validator.New()
+	if data.ValidateOwnerToken(v, token); !v.Valid() {
+		return "", errInvalidOwnerToken
+	}
+	return data.ListOwner(token), nil
+}
+
+// requireListOwner() returns the owner of the request's token, sending a 401
+// and returning false if there isn't a valid one
+func (app *application) requireListOwner(w http.ResponseWriter, r *http.Request) (string, bool) {
+	owner, err := app.listOwner(r)
+	if err != nil || owner == "" {
+		app.invalidOwnerTokenResponse(w, r)
+		return "", false
+	}
+	return owner, true
+}
+
+func (app *application) listListsHandler(w http.ResponseWriter, r *http.Request) {
+	owner, ok := app.requireListOwner(w, r)
+	if !ok {
+		return
+	}
+
+	lists, err := app.models.Lists.GetAllForOwner(owner)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"lists": lists}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createListHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name   string `json:"name"`
+		Public bool   `json:"public"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// a client without a token becomes the owner of a new one
+	owner, err := app.listOwner(r)
+	if err != nil {
+		app.invalidOwnerTokenResponse(w, r)
+		return
+	}
+	var token string
+	if owner == "" {
+		token, owner, err = data.NewOwnerToken()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	list := &data.List{
+		Owner:  owner,
+		Name:   input.Name,
+		Public: input.Public,
+	}
+
+	v := validator.New()
+	if data.ValidateList(v, list); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Lists.Insert(list)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/lists/%d", list.ID))
+
+	// the token is only ever sent this once
+	env := envelope{"list": list}
+	if token != "" {
+		env["owner_token"] = token
+	}
+
+	err = app.writeJSON(w, r, http.StatusCreated, env, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showListHandler returns a list with its movies. The :id can also be the
+// list's slug, which is what gets shared
+func (app *application) showListHandler(w http.ResponseWriter, r *http.Request) {
+	var slug string
+	id, err := app.readIDParam(r)
+	if err != nil {
+		slug = httprouter.ParamsFromContext(r.Context()).ByName("id")
+	}
+
+	owner, err := app.listOwner(r)
+	if err != nil {
+		app.invalidOwnerTokenResponse(w, r)
+		return
+	}
+
+	list, err := app.models.Lists.Get(id, slug, owner)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"list": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateListHandler renames a list or changes whether it is public
+func (app *application) updateListHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	owner, ok := app.requireListOwner(w, r)
+	if !ok {
+		return
+	}
+	list, err := app.models.Lists.Get(id, "", owner)
+	if err == nil && list.Owner != owner {
+		// someone else's public list can be read but not changed
+		err = data.ErrorRecordNotFound
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Name   string `json:"name"`
+		Public bool   `json:"public"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	list.Name = input.Name
+	list.Public = input.Public
+
+	v := validator.New()
+	if data.ValidateList(v, list); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Lists.Update(list)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"list": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteListHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	owner, ok := app.requireListOwner(w, r)
+	if !ok {
+		return
+	}
+
+	err = app.models.Lists.Delete(id, owner)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "list successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// addListItemHandler puts a movie on a list, at the end unless a position is given
+func (app *application) addListItemHandler(w http.ResponseWriter, r *http.Request) {
+	owner, ok := app.requireListOwner(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		MovieID  int64 `json:"movie_id"`
+		Position int   `json:"position"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.MovieID > 0, "movie_id", "must be a positive integer")
+	v.Check(input.Position >= 0, "position", "must not be negative")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Lists.AddItem(id, owner, input.MovieID, input.Position)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrMovieNotFound):
+			v.AddError("movie_id", "does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateListItem):
+			v.AddError("movie_id", "is already on the list")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeList(w, r, http.StatusCreated, id, owner)
+}
+
+// updateListItemHandler moves a movie to another position and/or marks it as
+// watched (on watched_on, or today) or not watched
+func (app *application) updateListItemHandler(w http.ResponseWriter, r *http.Request) {
+	owner, ok := app.requireListOwner(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	movieID, err := strconv.ParseInt(httprouter.ParamsFromContext(r.Context()).ByName("movie_id"), 10, 64)
+	if err != nil || movieID < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Position  *int       `json:"position"`
+		Watched   *bool      `json:"watched"`
+		WatchedOn *data.Date `json:"watched_on"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Position != nil || input.Watched != nil, "body", "must contain position or watched")
+	if input.Position != nil {
+		v.Check(*input.Position > 0, "position", "must be greater than zero")
+	}
+	if input.WatchedOn != nil {
+		v.Check(input.Watched != nil && *input.Watched, "watched_on", "must only be provided when watched is true")
+		v.Check(!input.WatchedOn.After(time.Now()), "watched_on", "must not be in the future")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	change := data.ListItemChange{Position: input.Position}
+	if input.Watched != nil {
+		change.SetWatched = true
+		change.WatchedOn = input.WatchedOn
+		if *input.Watched && change.WatchedOn == nil {
+			today := data.NewDate(time.Now())
+			change.WatchedOn = &today
+		}
+		if !*input.Watched {
+			change.WatchedOn = nil
+		}
+	}
+
+	err = app.models.Lists.UpdateItem(id, owner, movieID, change)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeList(w, r, http.StatusOK, id, owner)
+}
+
+func (app *application) removeListItemHandler(w http.ResponseWriter, r *http.Request) {
+	owner, ok := app.requireListOwner(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	movieID, err := strconv.ParseInt(httprouter.ParamsFromContext(r.Context()).ByName("movie_id"), 10, 64)
+	if err != nil || movieID < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Lists.RemoveItem(id, owner, movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeList(w, r, http.StatusOK, id, owner)
+}
+
+// helper that sends the list as it is after a change to its items
+func (app *application) writeList(w http.ResponseWriter, r *http.Request, status int, id int64, owner string) {
+	list, err := app.models.Lists.Get(id, "", owner)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, status, envelope{"list": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"greenlight.alexedwards.net/internal/data"
+)
+
+func TestListOwner(t *testing.T) {
+	app := &application{}
+	token, owner, err := data.NewOwnerToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		actor         string
+		want          string
+		wantErr       error
+	}{
+		{"no token", "", "", "", nil},
+		{"actor header isn't an owner", "", "someone", "", nil},
+		{"bearer token", "Bearer " + token, "", owner, nil},
+		{"not bearer", "Basic " + token, "", "", errInvalidOwnerToken},
+		{"no scheme", token, "", "", errInvalidOwnerToken},
+		{"short token", "Bearer abc", "", "", errInvalidOwnerToken},
+		{"empty token", "Bearer ", "", "", errInvalidOwnerToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/v1/lists", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.actor != "" {
+				r.Header.Set("X-Actor", tt.actor)
+			}
+
+			got, err := app.listOwner(r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v; want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got owner %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListHandlersRequireOwnerToken(t *testing.T) {
+	app := &application{}
+
+	tests := []struct {
+		name          string
+		authorization string
+	}{
+		{"no token", ""},
+		{"malformed token", "Bearer abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/v1/lists", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			rr := httptest.NewRecorder()
+
+			app.listListsHandler(rr, r)
+
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("got status %d; want %d", rr.Code, http.StatusUnauthorized)
+			}
+			if got := rr.Header().Get("WWW-Authenticate"); got != "Bearer" {
+				t.Errorf("got WWW-Authenticate %q; want %q", got, "Bearer")
+			}
+		})
+	}
+}
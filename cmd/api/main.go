@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
 	"flag"
 	"fmt"
@@ -13,6 +14,7 @@ import (
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 	"greenlight.alexedwards.net/internal/data"
+	"greenlight.alexedwards.net/internal/storage"
 )
 
 // global const that store API version
@@ -28,13 +30,40 @@ type config struct {
 		maxIdleConns int
 		maxIdleTime  string
 	}
+	cursor struct {
+		secret string
+	}
+	compress struct {
+		minSize int
+	}
+	idempotency struct {
+		ttl   time.Duration
+		lease time.Duration
+	}
+	trash struct {
+		retention time.Duration
+	}
+	similar struct {
+		refresh time.Duration
+	}
+	storage struct {
+		dir string
+	}
+	images struct {
+		decodes int
+	}
 }
 
 // struct that hold dependencies for our app
 type application struct {
-	config config
-	logger *log.Logger
-	models data.Models
+	config  config
+	logger  *log.Logger
+	models  data.Models
+	storage storage.Storage
+
+	// imageDecodes holds a slot for each image upload being decoded, so only
+	// config.images.decodes of them use the memory that takes at once
+	imageDecodes chan struct{}
 }
 
 func main() {
@@ -55,11 +84,35 @@ func main() {
 	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
 	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
 
+	flag.IntVar(&cfg.compress.minSize, "compress-min-size", 1024, "Minimum response size in bytes before compressing")
+
+	flag.DurationVar(&cfg.idempotency.ttl, "idempotency-ttl", 24*time.Hour, "How long Idempotency-Key responses are kept")
+	flag.DurationVar(&cfg.idempotency.lease, "idempotency-lease", 2*time.Minute, "How long an unfinished Idempotency-Key request holds its key before a retry can take it over")
+
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted movies stay in the trash before a purge removes them")
+
+	flag.DurationVar(&cfg.similar.refresh, "similar-refresh", 15*time.Minute, "How often similar movie scores are recomputed (0 disables)")
+
+	flag.StringVar(&cfg.storage.dir, "storage-dir", "./uploads", "Directory uploaded images are stored in")
+	flag.IntVar(&cfg.images.decodes, "image-decodes", 4, "Maximum number of uploaded images decoded at once")
+
+	flag.StringVar(&cfg.cursor.secret, "cursor-secret", os.Getenv("GREENLIGHT_CURSOR_SECRET"), "Secret key for signing pagination cursors")
+
 	flag.Parse()
 
 	// create logger that logs to the terminal(os.stout)
 	logger := log.New(os.Stdout, "", log.LstdFlags|log.Lshortfile)
 
+	// without a configured secret, sign cursors with a random key (cursors won't survive a restart)
+	if cfg.cursor.secret == "" {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			logger.Fatal(err)
+		}
+		cfg.cursor.secret = string(key)
+		logger.Printf("no cursor secret configured — using a random one")
+	}
+
 	// Open database connection pool
 	db, err := openDB(cfg)
 	if err != nil {
@@ -70,12 +123,29 @@ func main() {
 
 	logger.Printf("database connection pool established")
 
+	// uploaded images are kept on the local disk
+	store, err := storage.NewDisk(cfg.storage.dir)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
 	// create and instance of the application struct
 	app := &application{
 		config: cfg,
 		logger: logger,
 		// initialize model with our db connection
-		models: data.NewModels(db),
+		models:  data.NewModels(db),
+		storage: store,
+
+		imageDecodes: make(chan struct{}, max(cfg.images.decodes, 1)),
+	}
+
+	// remove expired idempotency keys in the background
+	go app.purgeIdempotencyKeys(time.Hour)
+
+	// keep the similar movie scores up to date in the background
+	if cfg.similar.refresh > 0 {
+		go app.refreshSimilarities(cfg.similar.refresh)
 	}
 
 	// create a new router (ServeMux)
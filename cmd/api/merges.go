@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"greenlight.alexedwards.net/internal/data"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+// listDuplicatesHandler lists pairs of movies that are probably the same film
+// entered twice: same normalized title and year, with runtimes no more than
+// ?runtime_tolerance minutes apart
+func (app *application) listDuplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	tolerance := app.readInt(qs, "runtime_tolerance", 5, v)
+	limit := app.readInt(qs, "limit", 20, v)
+
+	v.Check(tolerance >= 0, "runtime_tolerance", "must not be negative")
+	v.Check(tolerance <= data.MaxRuntimeTolerance, "runtime_tolerance", fmt.Sprintf("must be a maximum of %d", data.MaxRuntimeTolerance))
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= 100, "limit", "must be a maximum of 100")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	duplicates, err := app.models.Movies.Duplicates(tolerance, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"duplicates": duplicates}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// mergeMovieHandler folds the movie given as duplicate_id into the movie in
+// the URL, which is returned as it is after the merge
+func (app *application) mergeMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		DuplicateID int64 `json:"duplicate_id"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.DuplicateID > 0, "duplicate_id", "must be a positive integer")
+	v.Check(input.DuplicateID != id, "duplicate_id", "must not be the movie being merged into")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := app.modelsFor(r).Movies.Merge(id, input.DuplicateID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrMovieNotFound):
+			v.AddError("duplicate_id", "does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// mergedMovieResponse() sends a 301 to the movie a merged movie was folded
+// into, keeping the query string. It reports false if the id was never merged
+// or the movie it was merged into is in the trash, both of which are a 404
+func (app *application) mergedMovieResponse(w http.ResponseWriter, r *http.Request, id int64) (bool, error) {
+	targetID, err := app.models.Movies.MergedInto(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	location := fmt.Sprintf("/v1/movies/%d", targetID)
+	if r.URL.RawQuery != "" {
+		location += "?" + r.URL.RawQuery
+	}
+	headers := make(http.Header)
+	headers.Set("Location", location)
+
+	message := fmt.Sprintf("the movie was merged into movie %d", targetID)
+	return true, app.writeJSON(w, r, http.StatusMovedPermanently, envelope{"message": message}, headers)
+}
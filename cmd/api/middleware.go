@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// compressResponse() compresses response bodies with gzip or deflate when the
+// client accepts it. Bodies smaller than the configured minimum size are sent
+// as they are, because compressing them costs more than it saves
+func (app *application) compressResponse(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the body depends on Accept-Encoding, so caches must keep them apart
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{
+			ResponseWriter: w,
+			encoding:       encoding,
+			minSize:        app.config.compress.minSize,
+			status:         http.StatusOK,
+		}
+		defer func() {
+			// an aborted response must not have its body finished off
+			if p := recover(); p != nil {
+				panic(p)
+			}
+			if err := cw.Close(); err != nil {
+				app.logError(r, err)
+			}
+		}()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding() picks gzip or deflate from an Accept-Encoding header,
+// honouring q-values and preferring gzip when both are equally acceptable.
+// It returns "" if the body should not be compressed
+func negotiateEncoding(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		// q=0 means "not acceptable"
+		if q <= 0 {
+			continue
+		}
+
+		switch name {
+		case "gzip", "deflate":
+		case "*":
+			name = "gzip"
+		default:
+			continue
+		}
+
+		if q > bestQ || (q == bestQ && name == "gzip") {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// compressWriter holds back the start of the body until it knows whether the
+// body reaches minSize, then either switches to compressing or writes it as is
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	status      int
+	wroteHeader bool
+	buf         bytes.Buffer
+	decided     bool
+	compressor  io.WriteCloser // nil once decided means uncompressed
+}
+
+// WriteHeader() only records the status; it is sent once we know the encoding
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.status = status
+	cw.wroteHeader = true
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.decided {
+		cw.buf.Write(b)
+		if cw.buf.Len() < cw.minSize {
+			return len(b), nil
+		}
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	if cw.compressor != nil {
+		return cw.compressor.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// decide() sends the header, with or without Content-Encoding, and writes out
+// whatever was buffered so far
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+
+	h := cw.ResponseWriter.Header()
+	// never compress twice, and statuses without a body have nothing to compress
+	if h.Get("Content-Encoding") != "" || cw.status == http.StatusNoContent || cw.status == http.StatusNotModified {
+		compress = false
+	}
+	// bodies that are compressed already (archives, images) wouldn't get any smaller
+	if mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type")); alreadyCompressed(mediaType) {
+		compress = false
+	}
+
+	if compress {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+
+		if cw.encoding == "gzip" {
+			cw.compressor = gzip.NewWriter(cw.ResponseWriter)
+		} else {
+			// flate.NewWriter() only fails for an invalid level
+			cw.compressor, _ = flate.NewWriter(cw.ResponseWriter, flate.DefaultCompression)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if cw.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if cw.compressor != nil {
+		_, err = cw.compressor.Write(cw.buf.Bytes())
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf.Bytes())
+	}
+	cw.buf.Reset()
+	return err
+}
+
+// alreadyCompressed() reports whether a media type is a compressed format
+func alreadyCompressed(mediaType string) bool {
+	switch {
+	case mediaType == "application/gzip", mediaType == "application/zip":
+		return true
+	case strings.HasPrefix(mediaType, "image/") && mediaType != "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// Flush() lets streamed responses reach the client before the handler returns
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if err := cw.decide(cw.buf.Len() >= cw.minSize); err != nil {
+			return
+		}
+	}
+	if f, ok := cw.compressor.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close() finishes the response: a body that never reached minSize is sent uncompressed
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		if err := cw.decide(false); err != nil {
+			return err
+		}
+	}
+	if cw.compressor != nil {
+		return cw.compressor.Close()
+	}
+	return nil
+}
+
+// Unwrap() gives http.ResponseController access to the underlying writer
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
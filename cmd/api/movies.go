@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"greenlight.alexedwards.net/internal/data"
 	"greenlight.alexedwards.net/internal/validator"
@@ -15,6 +16,8 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 		Year    int32        `json:"year"`
 		Runtime data.Runtime `json:"runtime"` // using our custom Runtime type
 		Genres  []string     `json:"genres,omitempty"`
+
+		ExternalIDs data.ExternalIDs `json:"external_ids"`
 	}
 	err := app.readJSON(w, r, &input)
 	if err != nil {
@@ -28,13 +31,22 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 		Year:    input.Year,
 		Runtime: input.Runtime,
 		Genres:  input.Genres,
+
+		ExternalIDs: input.ExternalIDs,
+	}
+
+	// the genre index resolves genre names and aliases to their slugs
+	genres, err := app.models.Genres.Index()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	// create a new validator instance
 	v := validator.New()
 
 	// validate the movie
-	data.ValidateMovie(v, movie)
+	data.ValidateMovie(v, movie, genres)
 
 	// If validation fails, send errors back to client
 	if !v.Valid() {
@@ -42,10 +54,25 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// look for existing movies with a similar title; this never blocks the insert
+	warnings := make(map[string]string)
+	similar, err := app.models.Movies.FindSimilarTitles(movie.Title, 3)
+	if err != nil {
+		app.logError(r, err)
+	} else if len(similar) > 0 {
+		warnings["title"] = duplicateTitleWarning(similar)
+	}
+
 	// Insert the new movie into the database
-	err = app.models.Movies.Insert(movie)
+	err = app.modelsFor(r).Movies.Insert(movie)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			v.AddError("external_ids", err.Error())
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -53,8 +80,234 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
 
-	// Send a 201 Created response with the movie data in JSON format
-	err = app.writeJSON(w, http.StatusCreated, envelope{"movie": movie}, headers)
+	// Send a 201 Created response with the movie data (and any warnings) in JSON format
+	env := envelope{"movie": movie}
+	if len(warnings) > 0 {
+		env["warnings"] = warnings
+	}
+	err = app.writeJSON(w, r, http.StatusCreated, env, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// duplicateTitleWarning builds the warning message listing probable duplicates
+func duplicateTitleWarning(matches []*data.TitleMatch) string {
+	titles := make([]string, len(matches))
+	for i, match := range matches {
+		titles[i] = fmt.Sprintf("%q (%d, id %d)", match.Title, match.Year, match.ID)
+	}
+	return "similar to existing movies: " + strings.Join(titles, ", ")
+}
+
+func (app *application) suggestMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	// read the typeahead prefix and how many suggestions to return
+	prefix := app.readString(qs, "prefix", "")
+	limit := app.readInt(qs, "limit", 10, v)
+
+	v.Check(prefix != "", "prefix", "must be provided")
+	v.Check(len(prefix) <= 500, "prefix", "must not be more than 500 bytes long")
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= 25, "limit", "must be a maximum of 25")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	suggestions, err := app.models.Movies.SuggestTitles(prefix, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"suggestions": suggestions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	// struct to hold the expected query string values
+	var input struct {
+		Title  string
+		Genres []string
+		data.Filters
+	}
+
+	// work out the representation first so unsupported ones fail fast
+	format, err := app.negotiateFormat(r)
+	if err != nil {
+		app.notAcceptableResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	// read the filters, falling back to sensible defaults
+	input.Title = app.readString(qs, "title", "")
+	input.Genres, err = app.readGenres(qs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	input.Filters.PersonID = int64(app.readInt(qs, "person", 0, v))
+	v.Check(!qs.Has("person") || input.Filters.PersonID > 0, "person", "must be a positive integer")
+	input.Filters.Release = app.readReleaseFilter(qs, v)
+
+	// sparse fieldsets are selected in SQL; includes are embedded afterwards
+	fields, includes := app.readShape(qs, v)
+	input.Filters.Fields = fields
+	v.Check(len(includes) == 0 || format == formatJSON, "include", "is only supported for JSON responses")
+
+	// optional counts by genre, decade and runtime for the same filters
+	facetNames := app.readCSV(qs, "facets", []string{})
+	data.ValidateFacets(v, facetNames)
+	v.Check(len(facetNames) == 0 || format == formatJSON, "facets", "is only supported for JSON responses")
+
+	// the cursor is opaque to the client, so any decoding problem is reported the same way
+	if s := app.readString(qs, "cursor", ""); s != "" {
+		cursor, err := app.decodeCursor(s)
+		if err != nil {
+			v.AddError("cursor", "is invalid")
+		}
+		input.Filters.Cursor = cursor
+	}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// titles in the client's languages, when it asked for any we might have
+	languages := app.languages(w, r)
+
+	// the rest of the envelope is written before the movies stream, so count the facets first
+	var facets *data.Facets
+	if len(facetNames) > 0 {
+		facets, err = app.models.Movies.Facets(input.Title, input.Genres, input.Filters, facetNames)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	// includes are loaded for the whole page at once, so those responses are
+	// built in memory
+	if len(includes) > 0 {
+		app.writeMovieList(w, r, format, input.Title, input.Genres, input.Filters, includes, facets, languages)
+		return
+	}
+
+	// otherwise stream the page straight from the database rows
+	rows, err := app.models.Movies.StreamAll(input.Title, input.Genres, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	// the page's ids are known up front, so its titles can be translated as it streams
+	translations, err := app.titleTranslations(w, rows.IDs, languages)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// turn the next/prev cursors into links for the body and the Link header
+	pagination, headers, err := app.paginationLinks(r, rows.Metadata)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if format != formatJSON {
+		next := func() (*data.Movie, bool, error) {
+			if !rows.Next() {
+				return nil, false, rows.Err()
+			}
+			localizeTitle(rows.Movie(), translations)
+			return rows.Movie(), true, nil
+		}
+		err = app.writeMovies(w, r, format, http.StatusOK, true, next, fields, headers)
+		if err != nil {
+			app.abortResponse(r, err)
+		}
+		return
+	}
+
+	next := func() (interface{}, bool, error) {
+		if !rows.Next() {
+			return nil, false, rows.Err()
+		}
+		localizeTitle(rows.Movie(), translations)
+		if len(fields) == 0 {
+			return rows.Movie(), true, nil
+		}
+		projected, err := projectMovie(rows.Movie(), fields)
+		return projected, err == nil, err
+	}
+
+	env := envelope{"metadata": pagination}
+	if facets != nil {
+		env["facets"] = facets
+	}
+
+	// the status has been sent by the time a row fails, so the response is cut off
+	err = app.writeJSONStream(w, r, http.StatusOK, env, "movies", next, headers)
+	if err != nil {
+		app.abortResponse(r, err)
+	}
+}
+
+// writeMovieList() sends a page of movies with their titles translated into the
+// languages and the requested includes embedded, and the facets if any were
+// asked for. The page is still sorted by the untranslated titles
+func (app *application) writeMovieList(w http.ResponseWriter, r *http.Request, format, title string, genres []string, filters data.Filters, includes []string, facets *data.Facets, languages []string) {
+	movies, metadata, err := app.models.Movies.GetAll(title, genres, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.localizeMovies(w, movies, languages)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	pagination, headers, err := app.paginationLinks(r, metadata)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if format != formatJSON {
+		err = app.writeMovies(w, r, format, http.StatusOK, true, movieSlice(movies), filters.Fields, headers)
+		if err != nil {
+			app.abortResponse(r, err)
+		}
+		return
+	}
+
+	shaped, err := app.shapeMovies(movies, filters.Fields, includes)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"movies": shaped, "metadata": pagination}
+	if facets != nil {
+		env["facets"] = facets
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, env, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -68,20 +321,70 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// call Get() to fetch a movie data from database
-	movie, err := app.models.Movies.Get(id)
+	format, err := app.negotiateFormat(r)
+	if err != nil {
+		app.notAcceptableResponse(w, r)
+		return
+	}
+
+	// read the optional sparse fieldset and includes
+	v := validator.New()
+	fields, includes := app.readShape(r.URL.Query(), v)
+	v.Check(len(includes) == 0 || format == formatJSON, "include", "is only supported for JSON responses")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// call GetFields() to fetch only the requested movie data from database
+	movie, err := app.models.Movies.GetFields(id, fields)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrorRecordNotFound):
-			app.notFoundResponse(w, r)
+			// a movie merged into another moved there for good
+			redirected, err := app.mergedMovieResponse(w, r, id)
+			switch {
+			case err != nil:
+				app.serverErrorResponse(w, r, err)
+			case !redirected:
+				app.notFoundResponse(w, r)
+			}
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
+	// show the title in the client's language if we have it
+	err = app.localizeMovies(w, []*data.Movie{movie}, app.languages(w, r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if format != formatJSON {
+		err = app.writeMovies(w, r, format, http.StatusOK, false, singleMovie(movie), fields, nil)
+		if err != nil {
+			app.abortResponse(r, err)
+		}
+		return
+	}
+
+	shaped, err := app.shapeMovie(movie, fields, includes)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// the collection the movie belongs to, if any, with its neighbours in it
+	collection, err := app.models.Collections.SummaryFor(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	// If no error → send movie as JSON with HTTP 200 OK
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"movie": shaped, "collection": collection}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -112,6 +415,9 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		Year    int32        `json:"year"`
 		Runtime data.Runtime `json:"runtime"`
 		Genres  []string     `json:"genres,omitempty"`
+
+		// left out, the movie keeps the external ids it has
+		ExternalIDs *data.ExternalIDs `json:"external_ids"`
 	}
 
 	// Read JSON body into the struct
@@ -126,22 +432,39 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 	movie.Year = input.Year
 	movie.Runtime = input.Runtime
 	movie.Genres = input.Genres
+	if input.ExternalIDs != nil {
+		movie.ExternalIDs = *input.ExternalIDs
+	}
+
+	genres, err := app.models.Genres.Index()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 
 	// Validate the updated movie
 	v := validator.New()
-	if data.ValidateMovie(v, movie); !v.Valid() {
+	if data.ValidateMovie(v, movie, genres); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
 	// Save the updated record
-	err = app.models.Movies.Update(movie)
+	err = app.modelsFor(r).Movies.Update(movie)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			v.AddError("external_ids", err.Error())
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"movie": movie}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -156,7 +479,7 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Delete the movie from the database
-	err = app.models.Movies.Delete(id)
+	err = app.modelsFor(r).Movies.Delete(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrorRecordNotFound):
@@ -169,7 +492,7 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Return a success message.
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie successfully deleted"}, nil)
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "movie successfully deleted"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"greenlight.alexedwards.net/internal/data"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+// listRelatedMoviesHandler walks the relations graph out from a movie, up to
+// ?depth= steps away (1 by default)
+func (app *application) listRelatedMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	depth := app.readInt(r.URL.Query(), "depth", 1, v)
+	v.Check(depth > 0, "depth", "must be greater than zero")
+	v.Check(depth <= data.MaxRelationDepth, "depth", fmt.Sprintf("must be a maximum of %d", data.MaxRelationDepth))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// make sure the movie exists, since a movie with no relations has an empty graph
+	_, err = app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	related, err := app.models.Relations.Related(id, depth)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"related": related, "metadata": envelope{"depth": depth}}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createRelationHandler relates the movie to another one, e.g. {"related_id": 2,
+// "type": "remake"} says the movie is a remake of movie 2
+func (app *application) createRelationHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		RelatedID int64  `json:"related_id"`
+		Type      string `json:"type"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	relation := &data.Relation{
+		MovieID:   movieID,
+		RelatedID: input.RelatedID,
+		Type:      input.Type,
+	}
+
+	v := validator.New()
+	if data.ValidateRelation(v, relation); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Relations.Insert(relation)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrMovieNotFound):
+			v.AddError("related_id", "does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateRelation):
+			v.AddError("related_id", "is already related to this movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"relation": relation}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteRelationHandler removes a relation; either of its movies can be in the URL
+func (app *application) deleteRelationHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	id, err := strconv.ParseInt(httprouter.ParamsFromContext(r.Context()).ByName("relation_id"), 10, 64)
+	if err != nil || id < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Relations.Delete(movieID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "relation successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"greenlight.alexedwards.net/internal/data"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+// releaseInput is the body of a create or update release request
+type releaseInput struct {
+	Country       string    `json:"country"`
+	Date          data.Date `json:"date"`
+	Type          string    `json:"type"`
+	Certification string    `json:"certification"`
+}
+
+// readReleaseFilter() reads the ?country=, ?released_from= and ?released_to=
+// query string values that keep only movies released in that country and window
+func (app *application) readReleaseFilter(qs url.Values, v *validator.Validator) data.ReleaseFilter {
+	filter := data.ReleaseFilter{Country: strings.ToUpper(app.readString(qs, "country", ""))}
+
+	for key, bound := range map[string]**data.Date{"released_from": &filter.From, "released_to": &filter.To} {
+		if s := app.readString(qs, key, ""); s != "" {
+			var date data.Date
+			if err := date.UnmarshalText([]byte(s)); err != nil {
+				v.AddError(key, "must be a date in the form YYYY-MM-DD")
+				continue
+			}
+			*bound = &date
+		}
+	}
+
+	data.ValidateReleaseFilter(v, filter)
+	return filter
+}
+
+// readReleaseIDParam() reads the :release_id URL parameter
+func (app *application) readReleaseIDParam(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(httprouter.ParamsFromContext(r.Context()).ByName("release_id"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid release_id parameter")
+	}
+	return id, nil
+}
+
+func (app *application) listReleasesHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Movies.Get(movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	releases, err := app.models.Releases.GetAll(movieID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"releases": releases}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createReleaseHandler adds a release to a movie. The movie's year follows
+// its earliest release
+func (app *application) createReleaseHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input releaseInput
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	release := &data.Release{
+		MovieID:       movieID,
+		Country:       input.Country,
+		Date:          input.Date,
+		Type:          input.Type,
+		Certification: input.Certification,
+	}
+	app.writeRelease(w, r, release, http.StatusCreated, app.modelsFor(r).Releases.Insert)
+}
+
+// updateReleaseHandler replaces a release of a movie
+func (app *application) updateReleaseHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	id, err := app.readReleaseIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input releaseInput
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	release := &data.Release{
+		ID:            id,
+		MovieID:       movieID,
+		Country:       input.Country,
+		Date:          input.Date,
+		Type:          input.Type,
+		Certification: input.Certification,
+	}
+	app.writeRelease(w, r, release, http.StatusOK, app.modelsFor(r).Releases.Update)
+}
+
+// writeRelease() validates a release, saves it with save and sends it back
+// with the given status
+func (app *application) writeRelease(w http.ResponseWriter, r *http.Request, release *data.Release, status int, save func(*data.Release) error) {
+	v := validator.New()
+	if data.ValidateRelease(v, release); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err := save(release)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateRelease):
+			v.AddError("type", "the movie already has a release of this type in this country")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, status, envelope{"release": release}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteReleaseHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	id, err := app.readReleaseIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.modelsFor(r).Releases.Delete(movieID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "release successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
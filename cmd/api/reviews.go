@@ -0,0 +1,239 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"greenlight.alexedwards.net/internal/data"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+// reviewInput is the body of a create or update review request
+type reviewInput struct {
+	Author string `json:"author"`
+	Score  int32  `json:"score"`
+	Text   string `json:"text"`
+}
+
+// readReviewIDParams() reads the movie and review ids from the URL
+func (app *application) readReviewIDParams(r *http.Request) (int64, int64, error) {
+	movieID, err := app.readIDParam(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	id, err := strconv.ParseInt(httprouter.ParamsFromContext(r.Context()).ByName("review_id"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, 0, errors.New("invalid review id parameter")
+	}
+	return movieID, id, nil
+}
+
+func (app *application) listReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	pageSize := app.readInt(qs, "page_size", 20, v)
+	v.Check(pageSize > 0, "page_size", "must be greater than zero")
+	v.Check(pageSize <= 100, "page_size", "must be a maximum of 100")
+	cursor := app.readCursor(qs, data.ReviewSort, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// the movie is read for its rating totals, and to 404 if it doesn't exist
+	movie, err := app.models.Movies.Get(movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	reviews, metadata, err := app.models.Reviews.GetAll(movieID, pageSize, cursor)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	pagination, headers, err := app.paginationLinks(r, metadata)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	pagination["average_rating"] = movie.AverageRating
+	pagination["rating_count"] = movie.RatingCount
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"reviews": reviews, "metadata": pagination}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createReviewHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input reviewInput
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	review := &data.Review{
+		MovieID: movieID,
+		Author:  input.Author,
+		Score:   input.Score,
+		Text:    input.Text,
+	}
+
+	v := validator.New()
+	if data.ValidateReview(v, review); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Reviews.Insert(review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/movies/%d/reviews/%d", movieID, review.ID))
+
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"review": review}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showReviewHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, id, err := app.readReviewIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	review, err := app.models.Reviews.Get(movieID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"review": review}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateReviewHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, id, err := app.readReviewIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	review, err := app.models.Reviews.Get(movieID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// a client can say which version it edited, so it doesn't overwrite changes it hasn't seen
+	if expected := r.Header.Get("X-Expected-Version"); expected != "" && expected != strconv.Itoa(int(review.Version)) {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	var input reviewInput
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	review.Author = input.Author
+	review.Score = input.Score
+	review.Text = input.Text
+
+	v := validator.New()
+	if data.ValidateReview(v, review); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// the update only goes through if the review is still at the version read above
+	err = app.models.Reviews.Update(review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"review": review}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteReviewHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, id, err := app.readReviewIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Reviews.Delete(movieID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "review successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"greenlight.alexedwards.net/internal/data"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+func (app *application) listRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// the history is kept while a movie is in the trash and after it is merged
+	// into another, so it is listed then too
+	revisions, err := app.models.Revisions.GetAll(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"revisions": revisions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showRevisionHandler returns one revision of a movie along with the fields
+// that changed since the revision before it
+func (app *application) showRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	version, err := strconv.ParseInt(httprouter.ParamsFromContext(r.Context()).ByName("version"), 10, 32)
+	if err != nil || version < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	revision, err := app.models.Revisions.Get(id, int32(version))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	previous, err := app.models.Revisions.Previous(id, int32(version))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var previousMovie *data.Movie
+	var previousVersion *int32
+	if previous != nil {
+		previousMovie = previous.Movie
+		previousVersion = &previous.Version
+	}
+
+	env := envelope{
+		"revision":         revision,
+		"previous_version": previousVersion,
+		"changes":          data.DiffMovies(previousMovie, revision.Movie),
+	}
+	err = app.writeJSON(w, r, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revertMovieHandler restores the values of an earlier version. The result is
+// saved as a new version, so the revert itself shows up in the history
+func (app *application) revertMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Version int32 `json:"version"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Version > 0, "version", "must be a positive integer")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// a missing revision and a missing (or trashed) movie are both a 404
+	movie, err := app.modelsFor(r).Movies.Revert(id, input.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
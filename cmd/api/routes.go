@@ -6,7 +6,7 @@ import (
 	"github.com/julienschmidt/httprouter"
 )
 
-func (app *application) routes() *httprouter.Router {
+func (app *application) routes() http.Handler {
 	// create a new router
 	router := httprouter.New()
 
@@ -14,14 +14,110 @@ func (app *application) routes() *httprouter.Router {
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
+	// collection level actions that sit at the same position as the :id wildcard
+	getMovieActions := map[string]http.HandlerFunc{
+		"suggest":    app.suggestMoviesHandler,
+		"export":     app.exportMoviesHandler,
+		"trash":      app.listTrashHandler,
+		"lookup":     app.lookupMovieHandler,
+		"duplicates": app.listDuplicatesHandler,
+	}
+	postMovieActions := map[string]http.HandlerFunc{
+		"import": app.idempotent(app.importMoviesHandler),
+	}
+	deleteMovieActions := map[string]http.HandlerFunc{
+		"trash": app.purgeTrashHandler,
+	}
+
 	// bind each route to its handler
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/movies", app.createMovieHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.showMovieHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/movies", app.listMoviesHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/movies", app.idempotent(app.createMovieHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.dispatchActions(app.showMovieHandler, getMovieActions))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id", app.dispatchActions(app.methodNotAllowedResponse, postMovieActions))
 	router.HandlerFunc(http.MethodPut, "/v1/movies/:id", app.updateMovieHandler)
-	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.deleteMovieHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.dispatchActions(app.deleteMovieHandler, deleteMovieActions))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/restore", app.restoreMovieHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions", app.listRevisionsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions/:version", app.showRevisionHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/revert", app.idempotent(app.revertMovieHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/merge", app.idempotent(app.mergeMovieHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/reviews", app.listReviewsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/reviews", app.idempotent(app.createReviewHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/reviews/:review_id", app.showReviewHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/reviews/:review_id", app.updateReviewHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/reviews/:review_id", app.deleteReviewHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/credits", app.listCreditsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/credits", app.createCreditHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/credits/:credit_id", app.deleteCreditHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/related", app.listRelatedMoviesHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/similar", app.listSimilarMoviesHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/relations", app.createRelationHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/relations/:relation_id", app.deleteRelationHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/translations", app.listTranslationsHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/translations/:language", app.putTranslationHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/translations/:language", app.deleteTranslationHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/releases", app.listReleasesHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/releases", app.idempotent(app.createReleaseHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/releases/:release_id", app.updateReleaseHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/releases/:release_id", app.deleteReleaseHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/images", app.listImagesHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/images", app.idempotent(app.uploadImageHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/images/:image_id", app.deleteImageHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/images/:name", app.serveImageHandler)
+	router.HandlerFunc(http.MethodHead, "/v1/images/:name", app.serveImageHandler)
+
+	router.HandlerFunc(http.MethodPost, "/v1/batch", app.idempotent(app.batchHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/stats/movies", app.movieStatsHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/genres", app.listGenresHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/genres", app.createGenreHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/genres/:slug", app.showGenreHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/genres/:slug", app.updateGenreHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/genres/:slug", app.deleteGenreHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/genres/:slug/merge", app.mergeGenreHandler)
 
-	// return the router instance
-	return router
+	router.HandlerFunc(http.MethodGet, "/v1/people", app.listPeopleHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/people", app.idempotent(app.createPersonHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/people/:id", app.showPersonHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/people/:id", app.updatePersonHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/people/:id", app.deletePersonHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/lists", app.listListsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/lists", app.idempotent(app.createListHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/lists/:id", app.showListHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/lists/:id", app.updateListHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/lists/:id", app.deleteListHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/lists/:id/items", app.addListItemHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/lists/:id/items/:movie_id", app.updateListItemHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/lists/:id/items/:movie_id", app.removeListItemHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/collections", app.listCollectionsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/collections", app.idempotent(app.createCollectionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/collections/:id", app.showCollectionHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/collections/:id", app.updateCollectionHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/collections/:id", app.deleteCollectionHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/collections/:id/movies", app.addCollectionMovieHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/collections/:id/movies/:movie_id", app.updateCollectionMovieHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/collections/:id/movies/:movie_id", app.removeCollectionMovieHandler)
+
+	// wrap the router with the compression middleware
+	return app.compressResponse(router)
+
+}
 
+// httprouter panics if a static segment like "suggest" is registered next to the
+// :id wildcard, so dispatchActions() picks the action handler by the :id value and
+// falls back to next for anything else (e.g. a real movie id)
+func (app *application) dispatchActions(next http.HandlerFunc, actions map[string]http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+		if action, ok := actions[params.ByName("id")]; ok {
+			action(w, r)
+			return
+		}
+		next(w, r)
+	}
 }
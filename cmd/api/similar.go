@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"greenlight.alexedwards.net/internal/data"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+// listSimilarMoviesHandler recommends up to ?limit= movies (10 by default) like
+// the given one, saying why each was chosen
+func (app *application) listSimilarMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	limit := app.readInt(r.URL.Query(), "limit", 10, v)
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= data.MaxSimilarMovies, "limit", fmt.Sprintf("must be a maximum of %d", data.MaxSimilarMovies))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	similar, err := app.models.Similarities.Similar(id, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"similar": similar, "metadata": envelope{"limit": limit}}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// refreshSimilarities() recomputes the similar movie scores every interval; it runs for the lifetime of the server
+func (app *application) refreshSimilarities(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		start := time.Now()
+		if err := app.models.Similarities.Refresh(); err != nil {
+			app.logger.Println(err)
+			continue
+		}
+		app.logger.Printf("refreshed similar movies in %s", time.Since(start).Round(time.Millisecond))
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"greenlight.alexedwards.net/internal/data"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+// movieStatsHandler reports counts by genre, year and decade, runtime
+// percentiles and monthly edit activity for the movies matching the same
+// title, genres, person and release filters as the listing
+func (app *application) movieStatsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	var filter data.StatsFilter
+	filter.Title = app.readString(qs, "title", "")
+	genres, err := app.readGenres(qs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	filter.Genres = genres
+	filter.PersonID = int64(app.readInt(qs, "person", 0, v))
+	v.Check(!qs.Has("person") || filter.PersonID > 0, "person", "must be a positive integer")
+	filter.Release = app.readReleaseFilter(qs, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	stats, err := app.models.Stats.MovieStats(filter)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// the figures are cached for a short while anyway, so clients may do the same
+	headers := make(http.Header)
+	headers.Set("Cache-Control", fmt.Sprintf("max-age=%d", int(data.StatsTTL.Seconds())))
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"stats": stats}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math"
+
+	// register the decoders for every format in data.ImageTypes
+	_ "image/gif"
+)
+
+// thumbnailWidths are the widths smaller copies of uploaded images are made
+// at. An image no wider than one of them gets no thumbnail of that width
+var thumbnailWidths = []int32{185, 500}
+
+// thumbnailQuality is the JPEG quality thumbnails of JPEG images are saved at
+const thumbnailQuality = 85
+
+// encodeThumbnail() scales img down to width, keeping its aspect ratio, and
+// encodes it as JPEG or PNG depending on contentType
+func encodeThumbnail(img image.Image, width int, contentType string) ([]byte, error) {
+	thumbnail := resize(img, width)
+
+	var buf bytes.Buffer
+	var err error
+	if contentType == "image/jpeg" {
+		err = jpeg.Encode(&buf, thumbnail, &jpeg.Options{Quality: thumbnailQuality})
+	} else {
+		err = png.Encode(&buf, thumbnail)
+	}
+	return buf.Bytes(), err
+}
+
+// resize() scales img down to width, keeping its aspect ratio. Each new pixel
+// is the average of the pixels it covers (a box filter), worked out for the
+// rows first and then the columns. It is only meant for making images smaller.
+// The source is read a row at a time, so no full size copy of it is made
+func resize(img image.Image, width int) *image.RGBA {
+	bounds := img.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	height := int(math.Round(float64(srcHeight) * float64(width) / float64(srcWidth)))
+	if height < 1 {
+		height = 1
+	}
+
+	// averaging premultiplied colours keeps transparent pixels from bleeding in.
+	// An RGBA image already is, anything else is converted one row at a time
+	src, ok := img.(*image.RGBA)
+	var line *image.RGBA
+	if !ok {
+		line = image.NewRGBA(image.Rect(0, 0, srcWidth, 1))
+	}
+
+	rows := image.NewRGBA(image.Rect(0, 0, width, srcHeight))
+	for y := 0; y < srcHeight; y++ {
+		var pix []uint8
+		if src != nil {
+			pix = src.Pix[src.PixOffset(bounds.Min.X, bounds.Min.Y+y):]
+		} else {
+			draw.Draw(line, line.Bounds(), img, image.Pt(bounds.Min.X, bounds.Min.Y+y), draw.Src)
+			pix = line.Pix
+		}
+		for x := 0; x < width; x++ {
+			x0, x1 := span(x, width, srcWidth)
+			var sum [4]uint32
+			for sx := x0; sx < x1; sx++ {
+				addPixel(&sum, pix[sx*4:])
+			}
+			setPixel(rows.Pix[rows.PixOffset(x, y):], sum, uint32(x1-x0))
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := span(y, height, srcHeight)
+		for x := 0; x < width; x++ {
+			var sum [4]uint32
+			for sy := y0; sy < y1; sy++ {
+				addPixel(&sum, rows.Pix[rows.PixOffset(x, sy):])
+			}
+			setPixel(dst.Pix[dst.PixOffset(x, y):], sum, uint32(y1-y0))
+		}
+	}
+	return dst
+}
+
+// span() returns the range of source pixels that pixel i of n covers when
+// srcN pixels are shrunk to n. Every pixel covers at least one
+func span(i, n, srcN int) (int, int) {
+	start := i * srcN / n
+	end := (i + 1) * srcN / n
+	if end <= start {
+		end = start + 1
+	}
+	return start, end
+}
+
+func addPixel(sum *[4]uint32, pix []uint8) {
+	for c := 0; c < 4; c++ {
+		sum[c] += uint32(pix[c])
+	}
+}
+
+func setPixel(pix []uint8, sum [4]uint32, count uint32) {
+	for c := 0; c < 4; c++ {
+		pix[c] = uint8((sum[c] + count/2) / count)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestSpan(t *testing.T) {
+	tests := []struct {
+		name      string
+		i, n      int
+		srcN      int
+		wantStart int
+		wantEnd   int
+	}{
+		{"halving first", 0, 2, 4, 0, 2},
+		{"halving last", 1, 2, 4, 2, 4},
+		{"uneven first", 0, 3, 10, 0, 3},
+		{"uneven middle", 1, 3, 10, 3, 6},
+		{"uneven last", 2, 3, 10, 6, 10},
+		{"same size", 5, 10, 10, 5, 6},
+		{"to one pixel", 0, 1, 7, 0, 7},
+		{"growing still covers a pixel", 1, 4, 2, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := span(tt.i, tt.n, tt.srcN)
+			if start != tt.wantStart || end != tt.wantEnd {
+				t.Errorf("span(%d, %d, %d) = %d, %d; want %d, %d", tt.i, tt.n, tt.srcN, start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+// checkerboard() returns a w by h image alternating between two colours, in
+// an image type chosen by newImage
+func checkerboard(w, h int, a, b color.Color, newImage func(image.Rectangle) draw.Image) draw.Image {
+	img := newImage(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if (x+y)%2 == 0 {
+				img.Set(x, y, a)
+			} else {
+				img.Set(x, y, b)
+			}
+		}
+	}
+	return img
+}
+
+func TestResize(t *testing.T) {
+	black, white := color.RGBA{0, 0, 0, 255}, color.RGBA{255, 255, 255, 255}
+	newRGBA := func(r image.Rectangle) draw.Image { return image.NewRGBA(r) }
+	newNRGBA := func(r image.Rectangle) draw.Image { return image.NewNRGBA(r) }
+	newGray := func(r image.Rectangle) draw.Image { return image.NewGray(r) }
+
+	tests := []struct {
+		name       string
+		img        image.Image
+		width      int
+		wantBounds image.Rectangle
+		want       color.RGBA
+	}{
+		{"rgba averaged", checkerboard(8, 4, black, white, newRGBA), 4, image.Rect(0, 0, 4, 2), color.RGBA{128, 128, 128, 255}},
+		{"nrgba averaged", checkerboard(8, 4, black, white, newNRGBA), 4, image.Rect(0, 0, 4, 2), color.RGBA{128, 128, 128, 255}},
+		{"gray averaged", checkerboard(8, 4, black, white, newGray), 2, image.Rect(0, 0, 2, 1), color.RGBA{128, 128, 128, 255}},
+		{"transparent pixels don't bleed", checkerboard(4, 4, color.NRGBA{255, 0, 0, 255}, color.NRGBA{0, 0, 255, 0}, newNRGBA), 2, image.Rect(0, 0, 2, 2), color.RGBA{128, 0, 0, 128}},
+		{"height rounded", checkerboard(300, 200, black, black, newRGBA), 185, image.Rect(0, 0, 185, 123), color.RGBA{0, 0, 0, 255}},
+		{"height at least one", checkerboard(1000, 1, white, white, newRGBA), 10, image.Rect(0, 0, 10, 1), color.RGBA{255, 255, 255, 255}},
+		{"rgba sub-image", checkerboard(10, 10, black, white, newRGBA).(*image.RGBA).SubImage(image.Rect(3, 3, 7, 7)), 2, image.Rect(0, 0, 2, 2), color.RGBA{128, 128, 128, 255}},
+		{"nrgba sub-image", checkerboard(10, 10, black, white, newNRGBA).(*image.NRGBA).SubImage(image.Rect(3, 3, 7, 7)), 2, image.Rect(0, 0, 2, 2), color.RGBA{128, 128, 128, 255}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resize(tt.img, tt.width)
+			if got.Bounds() != tt.wantBounds {
+				t.Fatalf("bounds = %v; want %v", got.Bounds(), tt.wantBounds)
+			}
+			for y := 0; y < tt.wantBounds.Dy(); y++ {
+				for x := 0; x < tt.wantBounds.Dx(); x++ {
+					if c := got.RGBAAt(x, y); c != tt.want {
+						t.Fatalf("pixel (%d, %d) = %v; want %v", x, y, c, tt.want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeThumbnail(t *testing.T) {
+	img := checkerboard(400, 300, color.Black, color.White, func(r image.Rectangle) draw.Image { return image.NewRGBA(r) })
+
+	tests := []struct {
+		contentType string
+		decode      func(*bytes.Reader) (image.Image, error)
+	}{
+		{"image/jpeg", func(r *bytes.Reader) (image.Image, error) { return jpeg.Decode(r) }},
+		{"image/png", func(r *bytes.Reader) (image.Image, error) { return png.Decode(r) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			content, err := encodeThumbnail(img, 185, tt.contentType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			thumbnail, err := tt.decode(bytes.NewReader(content))
+			if err != nil {
+				t.Fatalf("thumbnail isn't a %s: %v", tt.contentType, err)
+			}
+			if got, want := thumbnail.Bounds().Size(), image.Pt(185, 139); got != want {
+				t.Errorf("thumbnail is %v; want %v", got, want)
+			}
+		})
+	}
+}
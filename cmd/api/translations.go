@@ -0,0 +1,238 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"greenlight.alexedwards.net/internal/data"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+// parseAcceptLanguage() returns the language tags of an Accept-Language header,
+// most preferred first. Tags with q=0 and the "*" wildcard are left out, since
+// any language not asked for ends up as the default one anyway
+func parseAcceptLanguage(header string) []string {
+	type languageRange struct {
+		tag string
+		q   float64
+	}
+	var ranges []languageRange
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				parsed = 0
+			}
+			q = parsed
+		}
+		if q <= 0 {
+			continue
+		}
+		ranges = append(ranges, languageRange{tag, q})
+	}
+
+	// equally preferred tags keep the order they were given in
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	tags := make([]string, len(ranges))
+	for i, lr := range ranges {
+		tags[i] = lr.tag
+	}
+	return tags
+}
+
+// languages() returns the languages to look for movie titles in, in order,
+// from the request's Accept-Language header. The response varies with the
+// header, and is in the default language until localizeMovies() says otherwise
+func (app *application) languages(w http.ResponseWriter, r *http.Request) []string {
+	w.Header().Add("Vary", "Accept-Language")
+	w.Header().Set("Content-Language", data.DefaultLanguage)
+
+	return data.LanguageFallbacks(parseAcceptLanguage(r.Header.Get("Accept-Language")))
+}
+
+// localizeMovies() replaces the titles of the movies with their best
+// translation into the languages, and sets the Content-Language header to the
+// languages the titles ended up in
+func (app *application) localizeMovies(w http.ResponseWriter, movies []*data.Movie, languages []string) error {
+	ids := make([]int64, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+	translations, err := app.titleTranslations(w, ids, languages)
+	if err != nil {
+		return err
+	}
+
+	for _, movie := range movies {
+		localizeTitle(movie, translations)
+	}
+	return nil
+}
+
+// localizeTitle() replaces a movie's title with its translation, if it has one
+func localizeTitle(movie *data.Movie, translations map[int64]*data.Translation) {
+	if translation, ok := translations[movie.ID]; ok {
+		movie.Title = translation.Title
+	}
+}
+
+// titleTranslations() loads the best translation into the languages of each
+// of the movies with the given ids, and sets the Content-Language header to
+// the languages their titles will be in. It is used before a page of movies
+// is streamed, so the header can go out ahead of the rows
+func (app *application) titleTranslations(w http.ResponseWriter, ids []int64, languages []string) (map[int64]*data.Translation, error) {
+	if len(ids) == 0 || len(languages) == 0 {
+		return nil, nil
+	}
+
+	translations, err := app.models.Translations.BestFor(ids, languages)
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]bool)
+	for _, id := range ids {
+		if translation, ok := translations[id]; ok {
+			used[translation.Language] = true
+		} else {
+			used[data.DefaultLanguage] = true
+		}
+	}
+
+	// list them in order of preference, with the default language last
+	var contentLanguages []string
+	for _, language := range languages {
+		if used[language] {
+			contentLanguages = append(contentLanguages, language)
+		}
+	}
+	if used[data.DefaultLanguage] {
+		contentLanguages = append(contentLanguages, data.DefaultLanguage)
+	}
+	w.Header().Set("Content-Language", strings.Join(contentLanguages, ", "))
+	return translations, nil
+}
+
+func (app *application) listTranslationsHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Movies.Get(movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	translations, err := app.models.Translations.GetAll(movieID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"translations": translations}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// putTranslationHandler sets the title of a movie in the language in the URL,
+// answering 201 Created for a new translation and 200 OK for a changed one
+func (app *application) putTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Title string `json:"title"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	translation := &data.Translation{
+		MovieID:  movieID,
+		Language: httprouter.ParamsFromContext(r.Context()).ByName("language"),
+		Title:    input.Title,
+	}
+
+	v := validator.New()
+	if data.ValidateTranslation(v, translation); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	created, err := app.models.Translations.Put(translation)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	err = app.writeJSON(w, r, status, envelope{"translation": translation}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	language, ok := data.CanonicalLanguage(httprouter.ParamsFromContext(r.Context()).ByName("language"))
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Translations.Delete(movieID, language)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "translation successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
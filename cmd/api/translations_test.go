@@ -0,0 +1,32 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   []string
+	}{
+		{"empty", "", []string{}},
+		{"single tag", "fr", []string{"fr"}},
+		{"q-values order the tags", "en;q=0.5, fr, de;q=0.8", []string{"fr", "de", "en"}},
+		{"ties keep their order", "pt-BR, pt, es;q=0.9, it;q=0.9", []string{"pt-BR", "pt", "es", "it"}},
+		{"spaces", "  de ; q=0.7 ,  fr-CA  ", []string{"fr-CA", "de"}},
+		{"q=0 is left out", "fr;q=0, de", []string{"de"}},
+		{"wildcard is left out", "*, fr;q=0.5", []string{"fr"}},
+		{"bad q counts as zero", "fr;q=lots, de", []string{"de"}},
+		{"empty parts", "fr,, ,de", []string{"fr", "de"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseAcceptLanguage(tt.header); !slices.Equal(got, tt.want) {
+				t.Errorf("parseAcceptLanguage(%q) = %q; want %q", tt.header, got, tt.want)
+			}
+		})
+	}
+}
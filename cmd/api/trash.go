@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"greenlight.alexedwards.net/internal/data"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+func (app *application) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	pageSize := app.readInt(qs, "page_size", 20, v)
+	v.Check(pageSize > 0, "page_size", "must be greater than zero")
+	v.Check(pageSize <= 100, "page_size", "must be a maximum of 100")
+	cursor := app.readCursor(qs, data.TrashSort, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movies, metadata, err := app.models.Movies.GetTrash(pageSize, cursor)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	pagination, headers, err := app.paginationLinks(r, metadata)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"movies": movies, "metadata": pagination}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) restoreMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// only movies that are in the trash can be restored
+	movie, err := app.modelsFor(r).Movies.Restore(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// purgeTrashHandler permanently deletes movies that have been in the trash for
+// longer than the retention period. ?older_than= (e.g. 168h) overrides the
+// configured retention for a single purge
+func (app *application) purgeTrashHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	retention := app.config.trash.retention
+	if s := app.readString(r.URL.Query(), "older_than", ""); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			v.AddError("older_than", "must be a duration such as 720h")
+		}
+		retention = d
+	}
+	v.Check(retention >= 0, "older_than", "must not be negative")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	purged, images, err := app.modelsFor(r).Movies.PurgeTrash(retention)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// the movies are gone either way, so failing to tidy up their files is only logged
+	if err := app.models.Images.RemoveUnused(images, app.removeImageFiles); err != nil {
+		app.logError(r, err)
+	}
+
+	message := fmt.Sprintf("%d movies permanently deleted", purged)
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": message, "purged": purged}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
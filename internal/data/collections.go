@@ -0,0 +1,401 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+// ErrDuplicateCollectionMovie is returned when a movie is added to a collection it is already in
+var ErrDuplicateCollectionMovie = errors.New("movie is already in the collection")
+
+// Collection groups movies that belong together, like the films of a trilogy, in order
+type Collection struct {
+	ID          int64              `json:"id"`
+	CreatedAt   time.Time          `json:"-"`
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	Version     int32              `json:"version"`
+	MovieCount  int                `json:"movie_count"`
+	Movies      []*CollectionMovie `json:"movies,omitempty"`
+}
+
+// CollectionMovie is a movie's place in a collection. Position counts from 1
+// over the movies shown, leaving out those in the trash, and positions given
+// when adding or moving a movie count the same way
+type CollectionMovie struct {
+	Position int    `json:"position"`
+	ID       int64  `json:"id"`
+	Title    string `json:"title"`
+	Year     int32  `json:"year,omitempty"`
+}
+
+// CollectionSummary is what a movie shows about the collection it is in: where
+// it comes in the collection and the movies either side of it
+type CollectionSummary struct {
+	ID       int64            `json:"id"`
+	Name     string           `json:"name"`
+	Position int              `json:"position"`
+	Size     int              `json:"size"`
+	Previous *CollectionMovie `json:"previous"`
+	Next     *CollectionMovie `json:"next"`
+}
+
+func ValidateCollection(v *validator.Validator, collection *Collection) {
+	v.Check(collection.Name != "", "name", "must be provided")
+	v.Check(len(collection.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(len(collection.Description) <= 5000, "description", "must not be more than 5000 bytes long")
+}
+
+// Define a CollectionModel struct which wraps a sql.DB connection pool
+type CollectionModel struct {
+	DB *sql.DB
+}
+
+func (m *CollectionModel) Insert(collection *Collection) error {
+	query := `
+    INSERT INTO collections (name, description)
+    VALUES ($1, $2)
+    RETURNING id, created_at, version`
+
+	return m.DB.QueryRow(query, collection.Name, collection.Description).Scan(&collection.ID, &collection.CreatedAt, &collection.Version)
+}
+
+// Get returns a collection with its movies in order, leaving out movies in the trash
+func (m *CollectionModel) Get(id int64) (*Collection, error) {
+	if id < 1 {
+		return nil, ErrorRecordNotFound
+	}
+
+	query := `
+    SELECT id, created_at, name, description, version
+    FROM collections
+    WHERE id = $1`
+
+	var collection Collection
+	err := m.DB.QueryRow(query, id).Scan(&collection.ID, &collection.CreatedAt, &collection.Name, &collection.Description, &collection.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	query = `
+    SELECT row_number() OVER (ORDER BY cm.position), m.id, m.title, m.year
+    FROM collection_movies cm
+    JOIN movies m ON m.id = cm.movie_id
+    WHERE cm.collection_id = $1 AND m.deleted_at IS NULL
+    ORDER BY cm.position`
+
+	rows, err := m.DB.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collection.Movies = []*CollectionMovie{}
+	for rows.Next() {
+		var movie CollectionMovie
+		if err := rows.Scan(&movie.Position, &movie.ID, &movie.Title, &movie.Year); err != nil {
+			return nil, err
+		}
+		collection.Movies = append(collection.Movies, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	collection.MovieCount = len(collection.Movies)
+	return &collection, nil
+}
+
+// GetAll returns a page of collections by name, without their movies. The
+// cursor is the name and id of the last collection seen (the first when going
+// backward), and nil starts from the beginning
+func (m *CollectionModel) GetAll(pageSize int, cursor *Cursor) ([]*Collection, Metadata, error) {
+	backward := cursor != nil && cursor.Backward
+
+	// one more than a page is read to tell whether there is another page
+	comparison, direction := ">", "ASC"
+	if backward {
+		comparison, direction = "<", "DESC"
+	}
+	query := fmt.Sprintf(`
+    SELECT c.id, c.created_at, c.name, c.description, c.version,
+        (SELECT count(*) FROM collection_movies cm JOIN movies m ON m.id = cm.movie_id
+         WHERE cm.collection_id = c.id AND m.deleted_at IS NULL)
+    FROM collections c
+    WHERE $2::bigint IS NULL OR (c.name, c.id) %s ($3, $2)
+    ORDER BY c.name %[2]s, c.id %[2]s
+    LIMIT $1`, comparison, direction)
+
+	var cursorID *int64
+	var cursorName string
+	if cursor != nil {
+		cursorID, cursorName = &cursor.ID, cursor.Value
+	}
+
+	rows, err := m.DB.Query(query, pageSize+1, cursorID, cursorName)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	collections := []*Collection{}
+	for rows.Next() {
+		var collection Collection
+		err := rows.Scan(
+			&collection.ID,
+			&collection.CreatedAt,
+			&collection.Name,
+			&collection.Description,
+			&collection.Version,
+			&collection.MovieCount,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		collections = append(collections, &collection)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	hasMore := len(collections) > pageSize
+	if hasMore {
+		collections = collections[:pageSize]
+	}
+	if backward {
+		slices.Reverse(collections)
+	}
+
+	// the same rules as for movies: see StreamAll()
+	metadata := Metadata{PageSize: pageSize}
+	if len(collections) > 0 {
+		first, last := collections[0], collections[len(collections)-1]
+		if hasMore || backward {
+			metadata.NextCursor = &Cursor{Sort: "name", Value: last.Name, ID: last.ID}
+		}
+		if (hasMore && backward) || (cursor != nil && !backward) {
+			metadata.PrevCursor = &Cursor{Sort: "name", Value: first.Name, ID: first.ID, Backward: true}
+		}
+	}
+	return collections, metadata, nil
+}
+
+func (m *CollectionModel) Update(collection *Collection) error {
+	query := `
+    UPDATE collections
+    SET name = $1, description = $2, version = version + 1
+    WHERE id = $3
+    RETURNING version`
+
+	err := m.DB.QueryRow(query, collection.Name, collection.Description, collection.ID).Scan(&collection.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrorRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a collection; its movies are left alone
+func (m *CollectionModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrorRecordNotFound
+	}
+
+	result, err := m.DB.Exec(`DELETE FROM collections WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrorRecordNotFound
+	}
+	return nil
+}
+
+// AddMovie puts a movie in a collection at the given position, moving the
+// movies from there on down by one. A position of 0 or past the end appends it.
+// It returns the position the movie ended up at
+func (m *CollectionModel) AddMovie(id, movieID int64, position int) (int, error) {
+	err := m.changeMovies(id, func(tx *sql.Tx) error {
+		var exists, inCollection bool
+		err := tx.QueryRow(`
+        SELECT EXISTS (SELECT 1 FROM movies WHERE id = $2 AND deleted_at IS NULL),
+            EXISTS (SELECT 1 FROM collection_movies WHERE collection_id = $1 AND movie_id = $2)`,
+			id, movieID).Scan(&exists, &inCollection)
+		switch {
+		case err != nil:
+			return err
+		case !exists:
+			return ErrMovieNotFound
+		case inCollection:
+			return ErrDuplicateCollectionMovie
+		}
+
+		var stored int
+		stored, position, err = collectionMovies.makeRoom(tx, id, position)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+        INSERT INTO collection_movies (collection_id, movie_id, position)
+        VALUES ($1, $2, $3)`, id, movieID, stored)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return position, nil
+}
+
+// MoveMovie moves a movie to a new position in a collection
+func (m *CollectionModel) MoveMovie(id, movieID int64, position int) error {
+	return m.changeMovies(id, func(tx *sql.Tx) error {
+		return collectionMovies.move(tx, id, movieID, position)
+	})
+}
+
+// RemoveMovie takes a movie out of a collection
+func (m *CollectionModel) RemoveMovie(id, movieID int64) error {
+	return m.changeMovies(id, func(tx *sql.Tx) error {
+		return collectionMovies.remove(tx, id, movieID)
+	})
+}
+
+// changeMovies() runs fn in a transaction holding a lock on the collection, whose
+// version goes up with every change to its movies. Missing rows are reported as
+// ErrorRecordNotFound
+func (m *CollectionModel) changeMovies(id int64, fn func(tx *sql.Tx) error) error {
+	err := withTx(m.DB, nil, func(tx *sql.Tx) error {
+		err := tx.QueryRow(`UPDATE collections SET version = version + 1 WHERE id = $1 RETURNING id`, id).Scan(&id)
+		if err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrorRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// SummaryFor returns the collection a movie is in, or nil if it isn't in one.
+// A movie in several collections gets the one it was added to first
+func (m *CollectionModel) SummaryFor(movieID int64) (*CollectionSummary, error) {
+	query := `
+    WITH collection AS (
+        SELECT c.id, c.name
+        FROM collection_movies cm
+        JOIN collections c ON c.id = cm.collection_id
+        WHERE cm.movie_id = $1
+        ORDER BY c.id
+        LIMIT 1
+    ), visible AS (
+        -- numbered like Get() numbers them, leaving out movies in the trash
+        SELECT m.id, m.title, m.year, row_number() OVER (ORDER BY cm.position) AS position
+        FROM collection_movies cm
+        JOIN movies m ON m.id = cm.movie_id
+        WHERE cm.collection_id = (SELECT id FROM collection) AND m.deleted_at IS NULL
+    ), members AS (
+        SELECT id AS movie_id, position,
+            count(*) OVER () AS size,
+            lag(id) OVER w AS prev_id, lag(title) OVER w AS prev_title,
+            lag(year) OVER w AS prev_year, lag(position) OVER w AS prev_position,
+            lead(id) OVER w AS next_id, lead(title) OVER w AS next_title,
+            lead(year) OVER w AS next_year, lead(position) OVER w AS next_position
+        FROM visible
+        WINDOW w AS (ORDER BY position)
+    )
+    SELECT collection.id, collection.name, members.position, members.size,
+        prev_id, prev_title, prev_year, prev_position,
+        next_id, next_title, next_year, next_position
+    FROM members, collection
+    WHERE members.movie_id = $1`
+
+	var summary CollectionSummary
+	var prevID, nextID sql.NullInt64
+	var prevTitle, nextTitle sql.NullString
+	var prevYear, nextYear, prevPosition, nextPosition sql.NullInt32
+	err := m.DB.QueryRow(query, movieID).Scan(
+		&summary.ID,
+		&summary.Name,
+		&summary.Position,
+		&summary.Size,
+		&prevID, &prevTitle, &prevYear, &prevPosition,
+		&nextID, &nextTitle, &nextYear, &nextPosition,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	if prevID.Valid {
+		summary.Previous = &CollectionMovie{Position: int(prevPosition.Int32), ID: prevID.Int64, Title: prevTitle.String, Year: prevYear.Int32}
+	}
+	if nextID.Valid {
+		summary.Next = &CollectionMovie{Position: int(nextPosition.Int32), ID: nextID.Int64, Title: nextTitle.String, Year: nextYear.Int32}
+	}
+	return &summary, nil
+}
+
+type MockCollectionModel struct{}
+
+func (m MockCollectionModel) Insert(collection *Collection) error {
+	return nil
+}
+
+func (m MockCollectionModel) Get(id int64) (*Collection, error) {
+	return nil, nil
+}
+
+func (m MockCollectionModel) GetAll(pageSize int, cursor *Cursor) ([]*Collection, Metadata, error) {
+	return nil, Metadata{}, nil
+}
+
+func (m MockCollectionModel) Update(collection *Collection) error {
+	return nil
+}
+
+func (m MockCollectionModel) Delete(id int64) error {
+	return nil
+}
+
+func (m MockCollectionModel) AddMovie(id, movieID int64, position int) (int, error) {
+	return 0, nil
+}
+
+func (m MockCollectionModel) MoveMovie(id, movieID int64, position int) error {
+	return nil
+}
+
+func (m MockCollectionModel) RemoveMovie(id, movieID int64) error {
+	return nil
+}
+
+func (m MockCollectionModel) SummaryFor(movieID int64) (*CollectionSummary, error) {
+	return nil, nil
+}
@@ -0,0 +1,73 @@
+package data
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// dateLayout is how dates are written everywhere in the API
+const dateLayout = "2006-01-02"
+
+// Error returned when a date isn't in the YYYY-MM-DD form
+var ErrInvalidDateFormat = errors.New("invalid date format")
+
+// Date is a calendar day without a time of day, stored in a PostgreSQL date column
+type Date struct {
+	time.Time
+}
+
+// NewDate returns the calendar day t falls on in its own location, as
+// midnight UTC of that day
+func NewDate(t time.Time) Date {
+	return Date{time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)}
+}
+
+// MarshalJSON writes the date as a "YYYY-MM-DD" string
+func (d Date) MarshalJSON() ([]byte, error) {
+	text, err := d.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strconv.Quote(string(text))), nil
+}
+
+func (d *Date) UnmarshalJSON(jsonValue []byte) error {
+	unquoted, err := strconv.Unquote(string(jsonValue))
+	if err != nil {
+		return ErrInvalidDateFormat
+	}
+	return d.UnmarshalText([]byte(unquoted))
+}
+
+// MarshalText gives the "YYYY-MM-DD" form used by every non-JSON format
+func (d Date) MarshalText() ([]byte, error) {
+	return []byte(d.Format(dateLayout)), nil
+}
+
+// UnmarshalText parses the "YYYY-MM-DD" form
+func (d *Date) UnmarshalText(text []byte) error {
+	t, err := time.Parse(dateLayout, string(text))
+	if err != nil {
+		return ErrInvalidDateFormat
+	}
+	d.Time = t
+	return nil
+}
+
+// Scan reads a date column, which pq gives as a time.Time
+func (d *Date) Scan(src interface{}) error {
+	t, ok := src.(time.Time)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into Date", src)
+	}
+	*d = NewDate(t)
+	return nil
+}
+
+// Value passes the date to PostgreSQL as a string, so no time zone can shift the day
+func (d Date) Value() (driver.Value, error) {
+	return d.Format(dateLayout), nil
+}
@@ -0,0 +1,69 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewDate(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	hawaii := time.FixedZone("HST", -10*60*60)
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want string
+	}{
+		{"utc", time.Date(2024, 2, 29, 13, 45, 0, 0, time.UTC), "2024-02-29"},
+		{"ahead of utc", time.Date(2024, 3, 1, 1, 0, 0, 0, tokyo), "2024-03-01"},
+		{"behind utc", time.Date(2024, 2, 29, 23, 0, 0, 0, hawaii), "2024-02-29"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDate(tt.t)
+			if got := d.Format(dateLayout); got != tt.want {
+				t.Errorf("got %s; want %s", got, tt.want)
+			}
+			if d.Location() != time.UTC || d.Hour() != 0 || d.Minute() != 0 {
+				t.Errorf("got %v; want midnight UTC", d.Time)
+			}
+		})
+	}
+}
+
+func TestDateUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json    string
+		want    string
+		wantErr error
+	}{
+		{`"2010-07-16"`, "2010-07-16", nil},
+		{`"2024-02-29"`, "2024-02-29", nil},
+		{`"2023-02-29"`, "", ErrInvalidDateFormat},
+		{`"16/07/2010"`, "", ErrInvalidDateFormat},
+		{`"2010-7-16"`, "", ErrInvalidDateFormat},
+		{`"2010-07-16T00:00:00Z"`, "", ErrInvalidDateFormat},
+		{`20100716`, "", ErrInvalidDateFormat},
+		{`""`, "", ErrInvalidDateFormat},
+	}
+
+	for _, tt := range tests {
+		var d Date
+		err := d.UnmarshalJSON([]byte(tt.json))
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("UnmarshalJSON(%s) error = %v; want %v", tt.json, err, tt.wantErr)
+			continue
+		}
+		if err == nil {
+			js, err := d.MarshalJSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(js) != `"`+tt.want+`"` {
+				t.Errorf("UnmarshalJSON(%s) then MarshalJSON() = %s; want %q", tt.json, js, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+// exportBatchSize is how many rows are fetched from the server-side cursor at a time
+const exportBatchSize = 500
+
+// ExportFilter narrows down which movies an export contains. Zero values mean no limit
+type ExportFilter struct {
+	Genres   []string
+	YearFrom int
+	YearTo   int
+}
+
+// ValidateExportFilter checks the year range of an export
+func ValidateExportFilter(v *validator.Validator, f ExportFilter) {
+	if f.YearFrom != 0 {
+		v.Check(f.YearFrom >= 1888, "year_from", "must be greater than 1888")
+	}
+	if f.YearTo != 0 {
+		v.Check(f.YearTo >= 1888, "year_to", "must be greater than 1888")
+	}
+	if f.YearFrom != 0 && f.YearTo != 0 {
+		v.Check(f.YearFrom <= f.YearTo, "year_to", "must not be before year_from")
+	}
+}
+
+// Export calls fn for every movie matching the filter, in id order. Rows are read
+// through a server-side cursor a batch at a time, so the table is never held in
+// memory. The context lets a disconnected client stop a long export
+func (m *MovieModel) Export(ctx context.Context, filter ExportFilter, fn func(*Movie) error) error {
+	// a cursor only lives as long as its transaction
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// DECLARE doesn't take bind parameters, so the filter values are written into
+	// the query: the years are integers and the genres are quoted literals
+	conditions := []string{"deleted_at IS NULL"}
+	if len(filter.Genres) > 0 {
+		quoted := make([]string, len(filter.Genres))
+		for i, genre := range filter.Genres {
+			quoted[i] = pq.QuoteLiteral(genre)
+		}
+		conditions = append(conditions, fmt.Sprintf("genres @> ARRAY[%s]::text[]", strings.Join(quoted, ", ")))
+	}
+	if filter.YearFrom != 0 {
+		conditions = append(conditions, fmt.Sprintf("year >= %d", filter.YearFrom))
+	}
+	if filter.YearTo != 0 {
+		conditions = append(conditions, fmt.Sprintf("year <= %d", filter.YearTo))
+	}
+
+	query := fmt.Sprintf(`
+    DECLARE movie_export NO SCROLL CURSOR FOR
+    SELECT %s
+    FROM movies
+    WHERE %s
+    ORDER BY id`, strings.Join(movieAllColumns, ", "), strings.Join(conditions, " AND "))
+
+	if _, err = tx.ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	fetch := fmt.Sprintf("FETCH FORWARD %d FROM movie_export", exportBatchSize)
+	for {
+		n, err := exportBatch(ctx, tx, fetch, fn)
+		if err != nil {
+			return err
+		}
+		// a short batch means the cursor is exhausted
+		if n < exportBatchSize {
+			return nil
+		}
+	}
+}
+
+// exportBatch() fetches the next batch from the export cursor and passes each
+// movie to fn, returning how many rows there were
+func exportBatch(ctx context.Context, tx *sql.Tx, fetch string, fn func(*Movie) error) (int, error) {
+	rows, err := tx.QueryContext(ctx, fetch)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		var movie Movie
+		if err := rows.Scan(movieScanDest(&movie, movieAllColumns)...); err != nil {
+			return n, err
+		}
+		if err := fn(&movie); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
@@ -0,0 +1,110 @@
+package data
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+// ErrDuplicateExternalID is returned when another movie already has one of the
+// external ids of a movie being saved. It is wrapped with the source, as in
+// "imdb id already belongs to another movie"
+var ErrDuplicateExternalID = errors.New("already belongs to another movie")
+
+// ExternalIDSources maps each database movies can be identified in to the
+// format of its ids
+var ExternalIDSources = map[string]*regexp.Regexp{
+	"imdb":     validator.IMDbIDRX,
+	"tmdb":     validator.TMDBIDRX,
+	"wikidata": validator.WikidataIDRX,
+}
+
+// externalIDIndexPrefix starts the names of the unique indexes on each source's
+// ids, which end in "_<source>_key"
+const externalIDIndexPrefix = "movies_external_ids_"
+
+// ExternalIDs holds the ids of a movie in other databases, keyed by source.
+// It is stored as a jsonb object
+type ExternalIDs map[string]string
+
+// Value stores the ids as a JSON object, an empty one if there are none. It is
+// text rather than []byte, which COPY would send as bytea
+func (e ExternalIDs) Value() (driver.Value, error) {
+	if e == nil {
+		return "{}", nil
+	}
+	js, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return string(js), nil
+}
+
+// Scan reads the ids from a jsonb column
+func (e *ExternalIDs) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*e = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(src, e)
+	case string:
+		return json.Unmarshal([]byte(src), e)
+	default:
+		return fmt.Errorf("cannot scan %T into ExternalIDs", src)
+	}
+}
+
+// ValidateExternalIDs checks that every id is from a known source and in that
+// source's format
+func ValidateExternalIDs(v *validator.Validator, ids ExternalIDs) {
+	for source, id := range ids {
+		rx, ok := ExternalIDSources[source]
+		if !ok {
+			v.AddError("external_ids", fmt.Sprintf("unknown source %q", source))
+			continue
+		}
+		v.Check(validator.Matches(id, rx), "external_ids", fmt.Sprintf("%q is not a valid %s id", id, source))
+	}
+}
+
+// duplicateExternalID() turns a unique violation on one of the external id
+// indexes into ErrDuplicateExternalID, naming the source. Other errors are
+// returned as they are
+func duplicateExternalID(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && strings.HasPrefix(pqErr.Constraint, externalIDIndexPrefix) {
+		source := strings.TrimSuffix(strings.TrimPrefix(pqErr.Constraint, externalIDIndexPrefix), "_key")
+		return fmt.Errorf("%s id %w", source, ErrDuplicateExternalID)
+	}
+	return err
+}
+
+// GetByExternalID returns the movie (outside the trash) with the given id in
+// the given source
+func (m *MovieModel) GetByExternalID(source, id string) (*Movie, error) {
+	columns := movieAllColumns
+	query := fmt.Sprintf(`
+    SELECT %s
+    FROM movies
+    WHERE external_ids @> jsonb_build_object($1::text, $2::text) AND deleted_at IS NULL`, strings.Join(columns, ", "))
+
+	var movie Movie
+	err := m.conn().QueryRow(query, source, id).Scan(movieScanDest(&movie, columns)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &movie, nil
+}
@@ -0,0 +1,91 @@
+package data
+
+import (
+	"maps"
+	"testing"
+
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+func TestValidateExternalIDs(t *testing.T) {
+	tests := []struct {
+		name    string
+		ids     ExternalIDs
+		wantErr bool
+	}{
+		{"none", nil, false},
+		{"all sources", ExternalIDs{"imdb": "tt0111161", "tmdb": "278", "wikidata": "Q172241"}, false},
+		{"long imdb id", ExternalIDs{"imdb": "tt10872600"}, false},
+		{"imdb without prefix", ExternalIDs{"imdb": "0111161"}, true},
+		{"short imdb id", ExternalIDs{"imdb": "tt123456"}, true},
+		{"imdb in upper case", ExternalIDs{"imdb": "TT0111161"}, true},
+		{"tmdb leading zero", ExternalIDs{"tmdb": "0278"}, true},
+		{"tmdb zero", ExternalIDs{"tmdb": "0"}, true},
+		{"tmdb not a number", ExternalIDs{"tmdb": "278a"}, true},
+		{"wikidata without prefix", ExternalIDs{"wikidata": "172241"}, true},
+		{"wikidata lower case", ExternalIDs{"wikidata": "q172241"}, true},
+		{"unknown source", ExternalIDs{"letterboxd": "the-shawshank-redemption"}, true},
+		{"empty id", ExternalIDs{"imdb": ""}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateExternalIDs(v, tt.ids)
+			if _, got := v.Errors["external_ids"]; got != tt.wantErr {
+				t.Errorf("got errors %v; want an external_ids error: %v", v.Errors, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExternalIDsScan(t *testing.T) {
+	tests := []struct {
+		name string
+		src  interface{}
+		want ExternalIDs
+	}{
+		{"null", nil, nil},
+		{"bytes", []byte(`{"imdb": "tt0111161"}`), ExternalIDs{"imdb": "tt0111161"}},
+		{"text", `{"tmdb": "278"}`, ExternalIDs{"tmdb": "278"}},
+		{"empty object", `{}`, ExternalIDs{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got ExternalIDs
+			if err := got.Scan(tt.src); err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(got, tt.want) || (got == nil) != (tt.want == nil) {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+		})
+	}
+
+	var ids ExternalIDs
+	if err := ids.Scan(42); err == nil {
+		t.Error("scanning an int succeeded; want an error")
+	}
+}
+
+func TestExternalIDsValue(t *testing.T) {
+	tests := []struct {
+		ids  ExternalIDs
+		want string
+	}{
+		{nil, "{}"},
+		{ExternalIDs{}, "{}"},
+		{ExternalIDs{"imdb": "tt0111161"}, `{"imdb":"tt0111161"}`},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.ids.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Value() of %v = %#v; want %q", tt.ids, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package data
+
+import (
+	"fmt"
+
+	"github.com/lib/pq"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+// FacetSafelist holds the facets the movie listing can be asked for
+var FacetSafelist = []string{"genres", "decade", "runtime"}
+
+// runtimeFacetEdges are the runtimes in minutes where one runtime bucket ends
+// and the next begins
+var runtimeFacetEdges = []int32{90, 120, 150}
+
+// Facets counts the movies matching a listing's filters by genre, decade and
+// runtime, so a client can show what narrowing the filters further would give.
+// Only the facets asked for are set
+type Facets struct {
+	Genres  []GenreCount    `json:"genres,omitempty"`
+	Decade  []DecadeCount   `json:"decade,omitempty"`
+	Runtime []RuntimeBucket `json:"runtime,omitempty"`
+}
+
+// RuntimeBucket counts the movies with a runtime from From up to but not
+// including To minutes. The first bucket has no From and the last no To
+type RuntimeBucket struct {
+	From  *int32 `json:"from"`
+	To    *int32 `json:"to"`
+	Count int64  `json:"count"`
+}
+
+func ValidateFacets(v *validator.Validator, facets []string) {
+	for _, facet := range facets {
+		v.Check(validator.In(facet, FacetSafelist...), "facets", fmt.Sprintf("invalid facet: %s", facet))
+	}
+	v.Check(validator.Unique(facets), "facets", "must not contain duplicate values")
+}
+
+// Facets counts the movies matching the title, genres, person and release
+// filters of a listing by each of the named facets. Paging doesn't affect the counts
+func (m *MovieModel) Facets(title string, genres []string, filters Filters, names []string) (*Facets, error) {
+	args := append([]interface{}{title, pq.Array(genres), filters.PersonID}, filters.Release.args()...)
+
+	facets := &Facets{}
+	for _, name := range names {
+		var err error
+		switch name {
+		case "genres":
+			facets.Genres, err = m.genreFacet(args)
+		case "decade":
+			facets.Decade, err = m.decadeFacet(args)
+		case "runtime":
+			facets.Runtime, err = m.runtimeFacet(args)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return facets, nil
+}
+
+// genreFacet() counts the movies in each genre. Since the genres filter only
+// keeps movies with all of the given genres, each count is how many movies
+// there would be with that genre added to the filter
+func (m *MovieModel) genreFacet(args []interface{}) ([]GenreCount, error) {
+	rows, err := m.conn().Query(filteredMoviesCTE+`
+    SELECT genre, count(*)
+    FROM filtered, unnest(genres) AS genre
+    GROUP BY genre
+    ORDER BY count(*) DESC, genre`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []GenreCount{}
+	for rows.Next() {
+		var count GenreCount
+		if err := rows.Scan(&count.Genre, &count.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+// decadeFacet() counts the movies released in each decade, oldest first
+func (m *MovieModel) decadeFacet(args []interface{}) ([]DecadeCount, error) {
+	rows, err := m.conn().Query(filteredMoviesCTE+`
+    SELECT year - year % 10 AS decade, count(*)
+    FROM filtered
+    GROUP BY decade
+    ORDER BY decade`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []DecadeCount{}
+	for rows.Next() {
+		var count DecadeCount
+		if err := rows.Scan(&count.Decade, &count.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+// runtimeFacet() counts the movies in each runtime bucket. Every bucket is
+// returned, including empty ones, so the buckets are always the same
+func (m *MovieModel) runtimeFacet(args []interface{}) ([]RuntimeBucket, error) {
+	buckets := make([]RuntimeBucket, len(runtimeFacetEdges)+1)
+	for i := range runtimeFacetEdges {
+		buckets[i].To = &runtimeFacetEdges[i]
+		buckets[i+1].From = &runtimeFacetEdges[i]
+	}
+
+	// width_bucket() numbers the buckets from 0, before the first edge
+	rows, err := m.conn().Query(filteredMoviesCTE+`
+    SELECT width_bucket(runtime, $7::integer[]), count(*)
+    FROM filtered
+    GROUP BY 1`, append(args, pq.Array(runtimeFacetEdges))...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bucket int
+		var count int64
+		if err := rows.Scan(&bucket, &count); err != nil {
+			return nil, err
+		}
+		if bucket >= 0 && bucket < len(buckets) {
+			buckets[bucket].Count = count
+		}
+	}
+	return buckets, rows.Err()
+}
@@ -0,0 +1,76 @@
+package data
+
+import (
+	"fmt"
+
+	"github.com/lib/pq"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+// MovieFieldSafelist holds the movie fields a client can ask for with ?fields=
+var MovieFieldSafelist = []string{"id", "title", "year", "runtime", "genres", "version", "average_rating", "rating_count", "external_ids"}
+
+// movieAllColumns is what gets selected when no fields were requested
+var movieAllColumns = []string{"id", "created_at", "title", "year", "runtime", "genres", "version", "average_rating", "rating_count", "external_ids"}
+
+// ValidateFields checks that the requested fields are known and not repeated
+func ValidateFields(v *validator.Validator, key string, fields []string, safelist []string) {
+	for _, field := range fields {
+		if !validator.In(field, safelist...) {
+			v.AddError(key, fmt.Sprintf("unknown field %q", field))
+			return
+		}
+	}
+	v.Check(validator.Unique(fields), key, "must not contain duplicate values")
+}
+
+// movieColumns() returns the columns to select for the requested fields. id is
+// always selected, as are any required columns (e.g. the one used for sorting)
+func movieColumns(fields []string, required ...string) []string {
+	if len(fields) == 0 {
+		return movieAllColumns
+	}
+
+	columns := []string{"id"}
+	for _, list := range [][]string{fields, required} {
+		for _, column := range list {
+			if !validator.In(column, columns...) {
+				columns = append(columns, column)
+			}
+		}
+	}
+	return columns
+}
+
+// movieScanDest() returns the Scan() destinations in the movie for the given columns
+func movieScanDest(movie *Movie, columns []string) []interface{} {
+	dest := make([]interface{}, len(columns))
+	for i, column := range columns {
+		switch column {
+		case "id":
+			dest[i] = &movie.ID
+		case "created_at":
+			dest[i] = &movie.CreatedAt
+		case "title":
+			dest[i] = &movie.Title
+		case "year":
+			dest[i] = &movie.Year
+		case "runtime":
+			dest[i] = &movie.Runtime
+		case "genres":
+			dest[i] = pq.Array(&movie.Genres)
+		case "version":
+			dest[i] = &movie.Version
+		case "average_rating":
+			dest[i] = &movie.AverageRating
+		case "rating_count":
+			dest[i] = &movie.RatingCount
+		case "external_ids":
+			dest[i] = &movie.ExternalIDs
+		default:
+			// columns always come from the safelist, so this is a programming error
+			panic("unknown movie column: " + column)
+		}
+	}
+	return dest
+}
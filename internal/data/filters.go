@@ -0,0 +1,109 @@
+package data
+
+import (
+	"strings"
+
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+// Filters holds the sorting and keyset pagination settings for a listing
+type Filters struct {
+	PageSize     int
+	Sort         string
+	SortSafelist []string
+	Cursor       *Cursor  // nil means start from the first page
+	Fields       []string // columns to select, empty means all of them
+	PersonID     int64    // only movies this person is credited on, 0 means any
+	Release      ReleaseFilter
+}
+
+// Cursor marks a position in a sorted listing: the sort key value and id of
+// the last (or first, when Backward) row that the client has already seen
+type Cursor struct {
+	Sort     string `json:"s"`
+	Value    string `json:"v"`
+	ID       int64  `json:"id"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+// Metadata holds the pagination details returned alongside a listing
+type Metadata struct {
+	PageSize   int     `json:"page_size"`
+	NextCursor *Cursor `json:"-"`
+	PrevCursor *Cursor `json:"-"`
+}
+
+// ValidateFilters checks the page size, sort value and cursor
+func ValidateFilters(v *validator.Validator, f Filters) {
+	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
+	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
+	v.Check(validator.In(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+	if f.Cursor != nil {
+		v.Check(f.Cursor.Sort == f.Sort, "cursor", "does not match the sort order")
+	}
+}
+
+// sortColumn() returns the column name from Sort after checking it against the safelist
+func (f Filters) sortColumn() string {
+	for _, safeValue := range f.SortSafelist {
+		if f.Sort == safeValue {
+			return strings.TrimPrefix(f.Sort, "-")
+		}
+	}
+	// this should never happen because ValidateFilters() already checked it
+	panic("unsafe sort parameter: " + f.Sort)
+}
+
+// sortDirection() returns "ASC" or "DESC" depending on the prefix of Sort
+func (f Filters) sortDirection() string {
+	if strings.HasPrefix(f.Sort, "-") {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+// backward() reports whether the page before the cursor is being requested
+func (f Filters) backward() bool {
+	return f.Cursor != nil && f.Cursor.Backward
+}
+
+// keysetClause() returns the SQL direction to order the query by and the
+// row comparison operator that selects rows after the cursor; when paging
+// backward both are flipped and the rows are reversed after reading
+func (f Filters) keysetClause() (direction, operator string) {
+	direction, operator = f.sortDirection(), ">"
+	if direction == "DESC" {
+		operator = "<"
+	}
+	if f.backward() {
+		if direction == "DESC" {
+			direction, operator = "ASC", ">"
+		} else {
+			direction, operator = "DESC", "<"
+		}
+	}
+	return direction, operator
+}
+
+// pageMetadata() returns the metadata of a page of a listing read with one
+// row more than fits, to tell whether there is another page. first and last
+// are cursors for the first and last rows as displayed, nil if the page is
+// empty. There is a next page if more rows were read going forward, or if we
+// came from it going backward; the same logic mirrored applies to the
+// previous page
+func pageMetadata(pageSize int, cursor *Cursor, hasMore bool, first, last *Cursor) Metadata {
+	metadata := Metadata{PageSize: pageSize}
+	if first == nil || last == nil {
+		return metadata
+	}
+
+	backward := cursor != nil && cursor.Backward
+	if hasMore || backward {
+		metadata.NextCursor = last
+	}
+	if (hasMore && backward) || (cursor != nil && !backward) {
+		first.Backward = true
+		metadata.PrevCursor = first
+	}
+	return metadata
+}
@@ -0,0 +1,53 @@
+package data
+
+import "testing"
+
+func TestPageMetadata(t *testing.T) {
+	first := func() *Cursor { return &Cursor{Sort: "name", Value: "a", ID: 1} }
+	last := func() *Cursor { return &Cursor{Sort: "name", Value: "z", ID: 9} }
+	forward := &Cursor{Sort: "name", Value: "m", ID: 5}
+	backward := &Cursor{Sort: "name", Value: "m", ID: 5, Backward: true}
+
+	tests := []struct {
+		name     string
+		cursor   *Cursor
+		hasMore  bool
+		empty    bool
+		wantNext bool
+		wantPrev bool
+	}{
+		{"only page", nil, false, false, false, false},
+		{"first of several", nil, true, false, true, false},
+		{"middle going forward", forward, true, false, true, true},
+		{"last going forward", forward, false, false, false, true},
+		{"middle going backward", backward, true, false, true, true},
+		{"first going backward", backward, false, false, true, false},
+		{"empty page", forward, false, true, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, l := first(), last()
+			if tt.empty {
+				f, l = nil, nil
+			}
+
+			metadata := pageMetadata(20, tt.cursor, tt.hasMore, f, l)
+			if metadata.PageSize != 20 {
+				t.Errorf("page size = %d; want 20", metadata.PageSize)
+			}
+			if (metadata.NextCursor != nil) != tt.wantNext {
+				t.Errorf("next cursor = %+v; want one: %v", metadata.NextCursor, tt.wantNext)
+			}
+			if (metadata.PrevCursor != nil) != tt.wantPrev {
+				t.Errorf("prev cursor = %+v; want one: %v", metadata.PrevCursor, tt.wantPrev)
+			}
+			if next := metadata.NextCursor; next != nil && (next.ID != 9 || next.Backward) {
+				t.Errorf("next cursor = %+v; want the last row going forward", *next)
+			}
+			if prev := metadata.PrevCursor; prev != nil && (prev.ID != 1 || !prev.Backward) {
+				t.Errorf("prev cursor = %+v; want the first row going backward", *prev)
+			}
+		})
+	}
+}
@@ -0,0 +1,386 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+var (
+	// ErrGenreInUse is returned when deleting a genre that movies still have
+	ErrGenreInUse = errors.New("genre is in use")
+	// ErrGenreNotFound is returned when a merge target doesn't exist
+	ErrGenreNotFound = errors.New("genre not found")
+)
+
+// genreIndexTTL is how long a GenreIndex is reused before it is loaded again.
+// Changes made through this process are seen straight away; other instances
+// of the API catch up within this time
+const genreIndexTTL = time.Minute
+
+// Genre is an entry in the genre taxonomy. Movies store the slug; the name is
+// for display and aliases are other spellings that resolve to the genre
+type Genre struct {
+	Slug       string    `json:"slug"`
+	CreatedAt  time.Time `json:"-"`
+	Name       string    `json:"name"`
+	Aliases    []string  `json:"aliases"`
+	Version    int32     `json:"version"`
+	MovieCount int64     `json:"movie_count"`
+}
+
+// GenreKey returns the form genre names are matched in: lower case, with
+// everything but letters and digits turned into single hyphens. Slugs and
+// aliases are stored as keys
+func GenreKey(name string) string {
+	return slugify(name)
+}
+
+// GenreIndex resolves genre names, slugs and aliases to slugs, ignoring case
+// and punctuation
+type GenreIndex struct {
+	keys map[string]string
+}
+
+// NewGenreIndex builds an index of the given genres
+func NewGenreIndex(genres []*Genre) *GenreIndex {
+	index := &GenreIndex{keys: make(map[string]string)}
+	for _, genre := range genres {
+		index.keys[genre.Slug] = genre.Slug
+		index.keys[GenreKey(genre.Name)] = genre.Slug
+		for _, alias := range genre.Aliases {
+			index.keys[alias] = genre.Slug
+		}
+	}
+	return index
+}
+
+// Resolve returns the slug of the genre that name refers to
+func (i *GenreIndex) Resolve(name string) (string, bool) {
+	slug, ok := i.keys[GenreKey(name)]
+	return slug, ok
+}
+
+// ResolveAll returns the slugs of the named genres, for filtering by genre.
+// Names that don't resolve are kept as keys, which no movie has
+func (i *GenreIndex) ResolveAll(names []string) []string {
+	slugs := make([]string, len(names))
+	for n, name := range names {
+		slug, ok := i.Resolve(name)
+		if !ok {
+			slug = GenreKey(name)
+		}
+		slugs[n] = slug
+	}
+	return slugs
+}
+
+// ValidateGenre checks a new or changed genre, normalizing its aliases to keys.
+// The index is used to make sure that no name it can be found by already
+// belongs to another genre
+func ValidateGenre(v *validator.Validator, genre *Genre, index *GenreIndex) {
+	v.Check(genre.Slug != "", "slug", "must be provided")
+	v.Check(genre.Slug == GenreKey(genre.Slug), "slug", "must only contain lower case letters, digits and single hyphens")
+	v.Check(genre.Name != "", "name", "must be provided")
+	v.Check(len(genre.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(len(genre.Aliases) <= 20, "aliases", "must not contain more than 20 aliases")
+
+	for i, alias := range genre.Aliases {
+		genre.Aliases[i] = GenreKey(alias)
+		v.Check(genre.Aliases[i] != "", "aliases", "must not contain empty values")
+	}
+	v.Check(validator.Unique(genre.Aliases), "aliases", "must not contain duplicate values")
+
+	if index == nil {
+		return
+	}
+	for field, names := range map[string][]string{"slug": {genre.Slug}, "name": {genre.Name}, "aliases": genre.Aliases} {
+		for _, name := range names {
+			if slug, ok := index.Resolve(name); ok && slug != genre.Slug {
+				v.AddError(field, fmt.Sprintf("%q already refers to the genre %q", name, slug))
+			}
+		}
+	}
+}
+
+// Define a GenreModel struct which wraps a sql.DB connection pool and keeps
+// the GenreIndex used to validate movies
+type GenreModel struct {
+	DB *sql.DB
+
+	mu       sync.Mutex
+	index    *GenreIndex
+	loadedAt time.Time
+}
+
+// Index returns an index of all genres, loading it if the cached one is stale
+func (m *GenreModel) Index() (*GenreIndex, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.index != nil && time.Since(m.loadedAt) < genreIndexTTL {
+		return m.index, nil
+	}
+
+	rows, err := m.DB.Query(`SELECT slug, name, aliases FROM genres`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var genres []*Genre
+	for rows.Next() {
+		var genre Genre
+		if err := rows.Scan(&genre.Slug, &genre.Name, pq.Array(&genre.Aliases)); err != nil {
+			return nil, err
+		}
+		genres = append(genres, &genre)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	m.index = NewGenreIndex(genres)
+	m.loadedAt = time.Now()
+	return m.index, nil
+}
+
+// invalidate() drops the cached index after a change to the genres
+func (m *GenreModel) invalidate() {
+	m.mu.Lock()
+	m.index = nil
+	m.mu.Unlock()
+}
+
+// GetAll returns every genre by name, with how many movies (outside the trash) have it
+func (m *GenreModel) GetAll() ([]*Genre, error) {
+	query := `
+    SELECT g.slug, g.created_at, g.name, g.aliases, g.version,
+        (SELECT count(*) FROM movies WHERE g.slug = ANY(genres) AND deleted_at IS NULL)
+    FROM genres g
+    ORDER BY g.name, g.slug`
+
+	rows, err := m.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := []*Genre{}
+	for rows.Next() {
+		var genre Genre
+		err := rows.Scan(&genre.Slug, &genre.CreatedAt, &genre.Name, pq.Array(&genre.Aliases), &genre.Version, &genre.MovieCount)
+		if err != nil {
+			return nil, err
+		}
+		genres = append(genres, &genre)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return genres, nil
+}
+
+func (m *GenreModel) Get(slug string) (*Genre, error) {
+	query := `
+    SELECT g.slug, g.created_at, g.name, g.aliases, g.version,
+        (SELECT count(*) FROM movies WHERE g.slug = ANY(genres) AND deleted_at IS NULL)
+    FROM genres g
+    WHERE g.slug = $1`
+
+	var genre Genre
+	err := m.DB.QueryRow(query, slug).Scan(&genre.Slug, &genre.CreatedAt, &genre.Name, pq.Array(&genre.Aliases), &genre.Version, &genre.MovieCount)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &genre, nil
+}
+
+func (m *GenreModel) Insert(genre *Genre) error {
+	// pq sends a nil slice as NULL
+	if genre.Aliases == nil {
+		genre.Aliases = []string{}
+	}
+
+	query := `
+    INSERT INTO genres (slug, name, aliases)
+    VALUES ($1, $2, $3)
+    RETURNING created_at, version`
+
+	err := m.DB.QueryRow(query, genre.Slug, genre.Name, pq.Array(genre.Aliases)).Scan(&genre.CreatedAt, &genre.Version)
+	if err != nil {
+		return err
+	}
+	m.invalidate()
+	return nil
+}
+
+// Update saves the name and aliases of a genre. The slug can't change, since
+// movies refer to it
+func (m *GenreModel) Update(genre *Genre) error {
+	// pq sends a nil slice as NULL
+	if genre.Aliases == nil {
+		genre.Aliases = []string{}
+	}
+
+	query := `
+    UPDATE genres
+    SET name = $1, aliases = $2, version = version + 1
+    WHERE slug = $3
+    RETURNING version`
+
+	err := m.DB.QueryRow(query, genre.Name, pq.Array(genre.Aliases), genre.Slug).Scan(&genre.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrorRecordNotFound
+		default:
+			return err
+		}
+	}
+	m.invalidate()
+	return nil
+}
+
+// Delete removes a genre that no movie has, including movies in the trash.
+// A genre that is in use has to be merged into another one instead
+func (m *GenreModel) Delete(slug string) error {
+	query := `
+    DELETE FROM genres
+    WHERE slug = $1
+    RETURNING EXISTS (SELECT 1 FROM movies WHERE $1 = ANY(genres))`
+
+	err := withTx(m.DB, nil, func(tx *sql.Tx) error {
+		var inUse bool
+		if err := tx.QueryRow(query, slug).Scan(&inUse); err != nil {
+			return err
+		}
+		// returning the error rolls the delete back
+		if inUse {
+			return ErrGenreInUse
+		}
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrorRecordNotFound
+		default:
+			return err
+		}
+	}
+	m.invalidate()
+	return nil
+}
+
+// Merge folds the genre from into the genre into: movies with from get into
+// instead (once), from, its name and its aliases become aliases of into, so
+// anything that resolved to from resolves to into afterwards, and from is
+// deleted. Each changed movie gets a new version recorded as made by actor.
+// It returns how many movies were changed
+func (m *GenreModel) Merge(from, into, actor string) (int64, error) {
+	var changed int64
+	err := withTx(m.DB, nil, func(tx *sql.Tx) error {
+		var name string
+		var aliases []string
+		err := tx.QueryRow(`SELECT name, aliases FROM genres WHERE slug = $1 FOR UPDATE`, from).Scan(&name, pq.Array(&aliases))
+		if err != nil {
+			return err
+		}
+		aliases = append(aliases, from)
+		if key := GenreKey(name); key != into {
+			aliases = append(aliases, key)
+		}
+
+		result, err := tx.Exec(`
+        UPDATE genres SET aliases = ARRAY(
+            SELECT DISTINCT alias FROM unnest(aliases || $2::text[]) AS alias ORDER BY alias
+        ), version = version + 1
+        WHERE slug = $1`, into, pq.Array(aliases))
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrGenreNotFound
+		}
+
+		// the movie revision trigger records who made the change
+		if _, err = tx.Exec(`SELECT set_config('greenlight.actor', $1, true)`, actor); err != nil {
+			return err
+		}
+
+		// replace from with into, keeping the first occurrence if the movie had both
+		result, err = tx.Exec(`
+        UPDATE movies m
+        SET genres = ARRAY(
+            SELECT genre
+            FROM unnest(array_replace(m.genres, $1, $2)) WITH ORDINALITY AS t(genre, position)
+            GROUP BY genre
+            ORDER BY min(position)
+        ), version = version + 1
+        WHERE $1 = ANY(m.genres)`, from, into)
+		if err != nil {
+			return err
+		}
+		if changed, err = result.RowsAffected(); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`DELETE FROM genres WHERE slug = $1`, from)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrorRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+	m.invalidate()
+	return changed, nil
+}
+
+type MockGenreModel struct{}
+
+func (m MockGenreModel) Index() (*GenreIndex, error) {
+	return nil, nil
+}
+
+func (m MockGenreModel) GetAll() ([]*Genre, error) {
+	return nil, nil
+}
+
+func (m MockGenreModel) Get(slug string) (*Genre, error) {
+	return nil, nil
+}
+
+func (m MockGenreModel) Insert(genre *Genre) error {
+	return nil
+}
+
+func (m MockGenreModel) Update(genre *Genre) error {
+	return nil
+}
+
+func (m MockGenreModel) Delete(slug string) error {
+	return nil
+}
+
+func (m MockGenreModel) Merge(from, into, actor string) (int64, error) {
+	return 0, nil
+}
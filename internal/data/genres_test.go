@@ -0,0 +1,120 @@
+package data
+
+import (
+	"slices"
+	"testing"
+
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+func TestGenreKey(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Drama", "drama"},
+		{"Science Fiction", "science-fiction"},
+		{"Sci-Fi", "sci-fi"},
+		{"  Film   Noir ", "film-noir"},
+		{"Rock 'n' Roll!", "rock-n-roll"},
+		{"--", ""},
+	}
+
+	for _, tt := range tests {
+		if got := GenreKey(tt.name); got != tt.want {
+			t.Errorf("GenreKey(%q) = %q; want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGenreIndexResolve(t *testing.T) {
+	index := NewGenreIndex([]*Genre{
+		{Slug: "science-fiction", Name: "Science Fiction", Aliases: []string{"sci-fi", "scifi"}},
+		{Slug: "drama", Name: "Drama"},
+		{Slug: "kids", Name: "Family Films"},
+	})
+
+	tests := []struct {
+		name   string
+		want   string
+		wantOK bool
+	}{
+		{"science-fiction", "science-fiction", true},
+		{"Science Fiction", "science-fiction", true},
+		{"SCI-FI", "science-fiction", true},
+		{"Sci Fi", "science-fiction", true},
+		{"scifi", "science-fiction", true},
+		{"drama", "drama", true},
+		{"kids", "kids", true},
+		{"family films", "kids", true},
+		{"horror", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := index.Resolve(tt.name)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("Resolve(%q) = %q, %v; want %q, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestGenreIndexResolveAll(t *testing.T) {
+	index := NewGenreIndex([]*Genre{
+		{Slug: "science-fiction", Name: "Science Fiction", Aliases: []string{"sci-fi"}},
+	})
+
+	got := index.ResolveAll([]string{"Sci-Fi", "Film Noir", "science fiction"})
+	want := []string{"science-fiction", "film-noir", "science-fiction"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestValidateGenre(t *testing.T) {
+	index := NewGenreIndex([]*Genre{
+		{Slug: "science-fiction", Name: "Science Fiction", Aliases: []string{"sci-fi"}},
+	})
+
+	tests := []struct {
+		name       string
+		genre      Genre
+		wantErrors []string
+	}{
+		{"valid", Genre{Slug: "film-noir", Name: "Film Noir", Aliases: []string{"Noir"}}, nil},
+		{"existing genre keeps its names", Genre{Slug: "science-fiction", Name: "Science Fiction", Aliases: []string{"sci-fi", "SF"}}, nil},
+		{"missing slug and name", Genre{}, []string{"slug", "name"}},
+		{"slug not a key", Genre{Slug: "Film Noir", Name: "Film Noir"}, []string{"slug"}},
+		{"empty alias", Genre{Slug: "film-noir", Name: "Film Noir", Aliases: []string{"!!"}}, []string{"aliases"}},
+		{"aliases duplicate once normalized", Genre{Slug: "film-noir", Name: "Film Noir", Aliases: []string{"Noir", "noir"}}, []string{"aliases"}},
+		{"name taken", Genre{Slug: "scifi", Name: "Sci Fi"}, []string{"name"}},
+		{"alias taken", Genre{Slug: "space-opera", Name: "Space Opera", Aliases: []string{"Science Fiction"}}, []string{"aliases"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateGenre(v, &tt.genre, index)
+			assertValidationErrors(t, v, tt.wantErrors)
+		})
+	}
+
+	genre := &Genre{Slug: "film-noir", Name: "Film Noir", Aliases: []string{"Neo Noir"}}
+	ValidateGenre(validator.New(), genre, nil)
+	if genre.Aliases[0] != "neo-noir" {
+		t.Errorf("alias normalized to %q; want %q", genre.Aliases[0], "neo-noir")
+	}
+}
+
+// assertValidationErrors() fails the test unless v has errors for exactly the given keys
+func assertValidationErrors(t *testing.T, v *validator.Validator, keys []string) {
+	t.Helper()
+	for _, key := range keys {
+		if _, ok := v.Errors[key]; !ok {
+			t.Errorf("no error for %q; got %v", key, v.Errors)
+		}
+	}
+	if len(v.Errors) != len(keys) {
+		t.Errorf("got errors %v; want them for %q", v.Errors, keys)
+	}
+}
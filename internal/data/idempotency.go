@@ -0,0 +1,142 @@
+package data
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrIdempotencyKeyMismatch is returned when a key is reused for a different request
+	ErrIdempotencyKeyMismatch = errors.New("idempotency key reused with a different request")
+	// ErrIdempotencyKeyInProgress is returned when the first request with a key hasn't finished yet
+	ErrIdempotencyKeyInProgress = errors.New("idempotency key in progress")
+)
+
+// StoredResponse is the response saved for an idempotency key so it can be replayed
+type StoredResponse struct {
+	Status  int
+	Headers map[string][]string
+	Body    []byte
+}
+
+// Define an IdempotencyModel struct which wraps a sql.DB connection pool
+type IdempotencyModel struct {
+	DB *sql.DB
+}
+
+// Reserve claims the key for a request with the given fingerprint for the
+// length of the lease. It returns nil if the key is new (or had expired) and
+// the request should go ahead, or the stored response if the same request was
+// already completed. A key that belongs to a different request gives
+// ErrIdempotencyKeyMismatch, and one whose first request is still running
+// gives ErrIdempotencyKeyInProgress until its lease runs out, when the same
+// request can take it over
+func (m *IdempotencyModel) Reserve(key string, fingerprint []byte, ttl, lease time.Duration) (*StoredResponse, error) {
+	// an expired key is taken over as if it had never been used
+	query := `
+    INSERT INTO idempotency_keys (key, fingerprint, expires_at, leased_until)
+    VALUES ($1, $2, NOW() + $3 * INTERVAL '1 second', NOW() + $4 * INTERVAL '1 second')
+    ON CONFLICT (key) DO UPDATE
+    SET fingerprint = EXCLUDED.fingerprint, status = NULL, headers = NULL, body = NULL,
+        created_at = NOW(), expires_at = EXCLUDED.expires_at, leased_until = EXCLUDED.leased_until
+    WHERE idempotency_keys.expires_at < NOW()
+    OR (idempotency_keys.status IS NULL AND idempotency_keys.leased_until < NOW()
+        AND idempotency_keys.fingerprint = EXCLUDED.fingerprint)
+    RETURNING key`
+
+	err := m.DB.QueryRow(query, key, fingerprint, int64(ttl.Seconds()), int64(lease.Seconds())).Scan(&key)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	// the key is live, so look at what it was used for
+	query = `
+    SELECT fingerprint, status, headers, body
+    FROM idempotency_keys
+    WHERE key = $1`
+
+	var stored StoredResponse
+	var storedFingerprint []byte
+	var status sql.NullInt32
+	var headers []byte
+	err = m.DB.QueryRow(query, key).Scan(&storedFingerprint, &status, &headers, &stored.Body)
+	if err != nil {
+		switch {
+		// released by a failed first request in the meantime; the client can retry
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrIdempotencyKeyInProgress
+		default:
+			return nil, err
+		}
+	}
+
+	switch {
+	case !bytes.Equal(storedFingerprint, fingerprint):
+		return nil, ErrIdempotencyKeyMismatch
+	case !status.Valid:
+		return nil, ErrIdempotencyKeyInProgress
+	}
+
+	stored.Status = int(status.Int32)
+	if err := json.Unmarshal(headers, &stored.Headers); err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// Complete saves the final response for a reserved key
+func (m *IdempotencyModel) Complete(key string, response *StoredResponse) error {
+	headers, err := json.Marshal(response.Headers)
+	if err != nil {
+		return err
+	}
+
+	query := `
+    UPDATE idempotency_keys
+    SET status = $1, headers = $2, body = $3
+    WHERE key = $4`
+
+	_, err = m.DB.Exec(query, response.Status, headers, response.Body, key)
+	return err
+}
+
+// Release frees a reserved key whose request failed, so that a retry can use it
+func (m *IdempotencyModel) Release(key string) error {
+	query := `DELETE FROM idempotency_keys WHERE key = $1 AND status IS NULL`
+	_, err := m.DB.Exec(query, key)
+	return err
+}
+
+// DeleteExpired removes expired keys and returns how many there were
+func (m *IdempotencyModel) DeleteExpired() (int64, error) {
+	query := `DELETE FROM idempotency_keys WHERE expires_at < NOW()`
+	result, err := m.DB.Exec(query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+type MockIdempotencyModel struct{}
+
+func (m MockIdempotencyModel) Reserve(key string, fingerprint []byte, ttl, lease time.Duration) (*StoredResponse, error) {
+	return nil, nil
+}
+
+func (m MockIdempotencyModel) Complete(key string, response *StoredResponse) error {
+	return nil
+}
+
+func (m MockIdempotencyModel) Release(key string) error {
+	return nil
+}
+
+func (m MockIdempotencyModel) DeleteExpired() (int64, error) {
+	return 0, nil
+}
@@ -0,0 +1,283 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+// ErrDuplicateImage is returned when the same file is uploaded to a movie twice
+var ErrDuplicateImage = errors.New("movie already has this image")
+
+// ImageKinds are what an image of a movie can show
+var ImageKinds = []string{"poster", "backdrop", "still"}
+
+// ImageTypes maps the content types images can have to the extension their
+// files are stored with
+var ImageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// MaxImageDimension is the largest width or height an image may have, in pixels
+const MaxImageDimension = 8000
+
+// MaxImagePixels is the most pixels an image may have in all. A decoded image
+// takes about 4 bytes a pixel, so this keeps one to around 160MB
+const MaxImagePixels = 40_000_000
+
+// Image is a picture of a movie. Its file is named after the SHA-256 of its
+// contents, and smaller copies of it are kept at each of the Thumbnails widths
+type Image struct {
+	ID          int64     `json:"id"`
+	MovieID     int64     `json:"movie_id"`
+	CreatedAt   time.Time `json:"-"`
+	Kind        string    `json:"kind"`
+	Hash        string    `json:"-"`
+	ContentType string    `json:"content_type"`
+	Width       int32     `json:"width"`
+	Height      int32     `json:"height"`
+	Size        int64     `json:"size"`
+	Thumbnails  []int32   `json:"-"`
+
+	// where the file and its thumbnails can be fetched from, set by the handlers
+	Files map[string]string `json:"files,omitempty"`
+}
+
+// FileName returns the name the image's file is stored under
+func (i *Image) FileName() string {
+	return i.Hash + ImageTypes[i.ContentType]
+}
+
+// ThumbnailType returns the content type of the image's thumbnails: JPEG
+// stays JPEG, and everything else becomes PNG so transparency is kept
+func (i *Image) ThumbnailType() string {
+	if i.ContentType == "image/jpeg" {
+		return "image/jpeg"
+	}
+	return "image/png"
+}
+
+// ThumbnailName returns the name the thumbnail of the given width is stored under
+func (i *Image) ThumbnailName(width int32) string {
+	return fmt.Sprintf("%s-w%d%s", i.Hash, width, ImageTypes[i.ThumbnailType()])
+}
+
+// FileNames returns the names of the image's file and all its thumbnails
+func (i *Image) FileNames() []string {
+	names := []string{i.FileName()}
+	for _, width := range i.Thumbnails {
+		names = append(names, i.ThumbnailName(width))
+	}
+	return names
+}
+
+func ValidateImage(v *validator.Validator, image *Image) {
+	v.Check(validator.In(image.Kind, ImageKinds...), "kind", "must be one of poster, backdrop or still")
+
+	_, ok := ImageTypes[image.ContentType]
+	v.Check(ok, "image", "must be a JPEG, PNG or GIF image")
+	v.Check(image.Width <= MaxImageDimension && image.Height <= MaxImageDimension, "image",
+		fmt.Sprintf("must not be wider or taller than %d pixels", MaxImageDimension))
+	v.Check(int64(image.Width)*int64(image.Height) <= MaxImagePixels, "image",
+		fmt.Sprintf("must not have more than %d pixels", MaxImagePixels))
+}
+
+// Define an ImageModel struct which wraps a sql.DB connection pool
+type ImageModel struct {
+	DB *sql.DB
+}
+
+// lockImageHash() takes a lock on an image hash until the transaction ends.
+// Adding an image and deleting unused files both hold it, so files can't be
+// deleted between being written and the row that uses them being added
+func lockImageHash(tx *sql.Tx, hash string) error {
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtextextended('movie_images:' || $1, 0))`, hash)
+	return err
+}
+
+// Insert adds an image to a movie, calling store to write its files once it
+// is known the row can be added. A movie that doesn't exist or is in the
+// trash gives ErrorRecordNotFound
+func (m *ImageModel) Insert(image *Image, store func() error) error {
+	query := `
+    INSERT INTO movie_images (movie_id, kind, hash, content_type, width, height, size, thumbnails)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+    RETURNING id, created_at`
+
+	args := []interface{}{
+		image.MovieID,
+		image.Kind,
+		image.Hash,
+		image.ContentType,
+		image.Width,
+		image.Height,
+		image.Size,
+		pq.Array(image.Thumbnails),
+	}
+
+	err := withTx(m.DB, nil, func(tx *sql.Tx) error {
+		if err := lockImageHash(tx, image.Hash); err != nil {
+			return err
+		}
+
+		// keep the movie out of the trash until the row is added
+		var id int64
+		err := tx.QueryRow(`SELECT id FROM movies WHERE id = $1 AND deleted_at IS NULL FOR SHARE`, image.MovieID).Scan(&id)
+		if err != nil {
+			return err
+		}
+		var exists bool
+		err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM movie_images WHERE movie_id = $1 AND hash = $2)`, image.MovieID, image.Hash).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrDuplicateImage
+		}
+
+		if err := store(); err != nil {
+			return err
+		}
+		return tx.QueryRow(query, args...).Scan(&image.ID, &image.CreatedAt)
+	})
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrorRecordNotFound
+		case errors.As(err, &pqErr) && pqErr.Code == "23505":
+			return ErrDuplicateImage
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAll returns the images of a movie by kind, oldest first
+func (m *ImageModel) GetAll(movieID int64) ([]*Image, error) {
+	query := `
+    SELECT id, movie_id, created_at, kind, hash, content_type, width, height, size, thumbnails
+    FROM movie_images
+    WHERE movie_id = $1
+    ORDER BY kind, id`
+
+	return queryImages(m.DB, query, movieID)
+}
+
+// queryImages() runs a query returning the columns scanImage() reads
+func queryImages(q querier, query string, args ...interface{}) ([]*Image, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []*Image{}
+	for rows.Next() {
+		image, err := scanImage(rows)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// Delete removes an image from a movie and returns it, so its files can be
+// passed to RemoveUnused
+func (m *ImageModel) Delete(movieID, id int64) (*Image, error) {
+	query := `
+    DELETE FROM movie_images
+    WHERE id = $1 AND movie_id = $2
+    RETURNING id, movie_id, created_at, kind, hash, content_type, width, height, size, thumbnails`
+
+	image, err := scanImage(m.DB.QueryRow(query, id, movieID))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return image, nil
+}
+
+// RemoveUnused calls remove for each of the given images, which have been
+// deleted, whose hash no image has any more, so that its files can be
+// deleted. The hash is locked while remove runs, so an upload of the same
+// file waits for the files to be gone before writing them again
+func (m *ImageModel) RemoveUnused(images []*Image, remove func(*Image) error) error {
+	seen := make(map[string]bool)
+	for _, image := range images {
+		if seen[image.Hash] {
+			continue
+		}
+		seen[image.Hash] = true
+
+		err := withTx(m.DB, nil, func(tx *sql.Tx) error {
+			if err := lockImageHash(tx, image.Hash); err != nil {
+				return err
+			}
+			var inUse bool
+			err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM movie_images WHERE hash = $1)`, image.Hash).Scan(&inUse)
+			if err != nil || inUse {
+				return err
+			}
+			return remove(image)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanImage() reads an image from a row of the columns GetAll() selects
+func scanImage(row rowScanner) (*Image, error) {
+	var image Image
+	err := row.Scan(
+		&image.ID,
+		&image.MovieID,
+		&image.CreatedAt,
+		&image.Kind,
+		&image.Hash,
+		&image.ContentType,
+		&image.Width,
+		&image.Height,
+		&image.Size,
+		pq.Array(&image.Thumbnails),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
+
+type MockImageModel struct{}
+
+func (m MockImageModel) Insert(image *Image, store func() error) error {
+	return store()
+}
+
+func (m MockImageModel) GetAll(movieID int64) ([]*Image, error) {
+	return nil, nil
+}
+
+func (m MockImageModel) Delete(movieID, id int64) (*Image, error) {
+	return nil, nil
+}
+
+func (m MockImageModel) RemoveUnused(images []*Image, remove func(*Image) error) error {
+	return nil
+}
@@ -0,0 +1,53 @@
+package data
+
+import (
+	"slices"
+	"testing"
+
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+func TestValidateImage(t *testing.T) {
+	tests := []struct {
+		name       string
+		image      Image
+		wantErrors []string
+	}{
+		{"valid", Image{Kind: "poster", ContentType: "image/jpeg", Width: 2000, Height: 3000}, nil},
+		{"largest allowed", Image{Kind: "still", ContentType: "image/gif", Width: 5000, Height: 8000}, nil},
+		{"unknown kind", Image{Kind: "logo", ContentType: "image/png", Width: 100, Height: 100}, []string{"kind"}},
+		{"unknown type", Image{Kind: "poster", ContentType: "image/webp", Width: 100, Height: 100}, []string{"image"}},
+		{"too wide", Image{Kind: "backdrop", ContentType: "image/png", Width: 8001, Height: 10}, []string{"image"}},
+		{"too many pixels", Image{Kind: "backdrop", ContentType: "image/png", Width: 8000, Height: 5001}, []string{"image"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateImage(v, &tt.image)
+			assertValidationErrors(t, v, tt.wantErrors)
+		})
+	}
+}
+
+func TestImageFileNames(t *testing.T) {
+	hash := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+	tests := []struct {
+		name  string
+		image Image
+		want  []string
+	}{
+		{"jpeg", Image{Hash: hash, ContentType: "image/jpeg", Thumbnails: []int32{185, 500}}, []string{hash + ".jpg", hash + "-w185.jpg", hash + "-w500.jpg"}},
+		{"gif thumbnails are png", Image{Hash: hash, ContentType: "image/gif", Thumbnails: []int32{185}}, []string{hash + ".gif", hash + "-w185.png"}},
+		{"no thumbnails", Image{Hash: hash, ContentType: "image/png"}, []string{hash + ".png"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.image.FileNames(); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,445 @@
+package data
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+var (
+	// ErrDuplicateListItem is returned when a movie is added to a list it is already on
+	ErrDuplicateListItem = errors.New("movie is already on the list")
+	// ErrMovieNotFound is returned when a movie referred to by another record doesn't exist
+	ErrMovieNotFound = errors.New("movie not found")
+)
+
+// List is a user's ordered list of movies, e.g. things to watch. Lists are
+// private to their owner unless made public, when anyone with the slug can see
+// them. Owner is the ListOwner() of the owner's token, which is never sent back
+type List struct {
+	ID        int64       `json:"id"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+	Owner     string      `json:"-"`
+	Name      string      `json:"name"`
+	Public    bool        `json:"public"`
+	Slug      string      `json:"slug"`
+	Version   int32       `json:"version"`
+	Items     []*ListItem `json:"items,omitempty"`
+}
+
+// ListItem is a movie on a list. Position counts from 1 over the movies shown,
+// leaving out those in the trash
+type ListItem struct {
+	MovieID   int64     `json:"movie_id"`
+	Position  int       `json:"position"`
+	AddedAt   time.Time `json:"added_at"`
+	WatchedOn *Date     `json:"watched_on"` // nil until the movie is marked watched
+	Movie     *Movie    `json:"movie,omitempty"`
+}
+
+// ownerTokenLength is the length of the tokens NewOwnerToken() makes: 16
+// random bytes in unpadded base32
+const ownerTokenLength = 26
+
+// NewOwnerToken returns a random secret token for a new list owner, which is
+// all that proves a request comes from them, and the owner it stands for
+func NewOwnerToken() (token, owner string, err error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)
+	return token, ListOwner(token), nil
+}
+
+// ListOwner returns the owner that lists are stored under for a token. Only
+// the SHA-256 of the token is kept, so the database can't be used to act as
+// an owner
+func ListOwner(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidateOwnerToken checks that a token is in the form NewOwnerToken() makes
+func ValidateOwnerToken(v *validator.Validator, token string) {
+	v.Check(token != "", "token", "must be provided")
+	v.Check(len(token) == ownerTokenLength, "token", fmt.Sprintf("must be %d bytes long", ownerTokenLength))
+}
+
+// ValidateList checks the fields a client can set on a list
+func ValidateList(v *validator.Validator, list *List) {
+	v.Check(strings.TrimSpace(list.Name) != "", "name", "must be provided")
+	v.Check(len(list.Name) <= 200, "name", "must not be more than 200 bytes long")
+}
+
+// slugSeparatorRX matches the runs of characters that are replaced by a hyphen in a slug
+var slugSeparatorRX = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugify() lower cases s and replaces everything but letters and digits with
+// single hyphens, e.g. "Sci-Fi & Fantasy!" becomes "sci-fi-fantasy"
+func slugify(s string) string {
+	return strings.Trim(slugSeparatorRX.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+// newListSlug() makes a slug from the list name with a random suffix, so that it
+// can't be guessed and two lists with the same name get different slugs
+func newListSlug(name string) (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+
+	base := slugify(name)
+	if len(base) > 50 {
+		base = strings.TrimRight(base[:50], "-")
+	}
+	if base == "" {
+		base = "list"
+	}
+	return base + "-" + hex.EncodeToString(suffix), nil
+}
+
+// Define a ListModel struct which wraps a sql.DB connection pool. Every method
+// takes the owner making the request: a list that is neither owned by them nor
+// (for reads) public is reported as not found. Lists made before owners had
+// tokens have no owner, and "" is the owner of requests without a token, so
+// neither can ever change a list
+type ListModel struct {
+	DB *sql.DB
+}
+
+// Insert creates a list with a new slug. The slug stays the same if the list
+// is renamed, so shared links keep working
+func (m *ListModel) Insert(list *List) error {
+	query := `
+    INSERT INTO lists (owner, name, public, slug)
+    VALUES ($1, $2, $3, $4)
+    RETURNING id, created_at, updated_at, version`
+
+	// a clash between random suffixes is unlikely but not impossible
+	for attempt := 0; ; attempt++ {
+		slug, err := newListSlug(list.Name)
+		if err != nil {
+			return err
+		}
+
+		err = m.DB.QueryRow(query, list.Owner, list.Name, list.Public, slug).Scan(&list.ID, &list.CreatedAt, &list.UpdatedAt, &list.Version)
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" && attempt < 3 {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		list.Slug = slug
+		return nil
+	}
+}
+
+// Get returns a list with its items, by id or by slug (exactly one of them is
+// used). The owner sees their own lists; anyone else only public ones
+func (m *ListModel) Get(id int64, slug string, owner string) (*List, error) {
+	query := `
+    SELECT id, created_at, updated_at, coalesce(owner, ''), name, public, slug, version
+    FROM lists
+    WHERE (id = $1 OR slug = $2) AND (owner = $3 OR public)`
+
+	var list List
+	err := m.DB.QueryRow(query, id, slug, owner).Scan(
+		&list.ID,
+		&list.CreatedAt,
+		&list.UpdatedAt,
+		&list.Owner,
+		&list.Name,
+		&list.Public,
+		&list.Slug,
+		&list.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	list.Items, err = m.getItems(list.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// getItems() returns the items of a list in order, leaving out movies in the trash
+func (m *ListModel) getItems(listID int64) ([]*ListItem, error) {
+	query := `
+    SELECT li.movie_id, row_number() OVER (ORDER BY li.position), li.added_at, li.watched_on, m.title, m.year, m.runtime, m.genres
+    FROM list_items li
+    JOIN movies m ON m.id = li.movie_id
+    WHERE li.list_id = $1 AND m.deleted_at IS NULL
+    ORDER BY li.position`
+
+	rows, err := m.DB.Query(query, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*ListItem{}
+	for rows.Next() {
+		item := ListItem{Movie: &Movie{}}
+		err := rows.Scan(
+			&item.MovieID,
+			&item.Position,
+			&item.AddedAt,
+			&item.WatchedOn,
+			&item.Movie.Title,
+			&item.Movie.Year,
+			&item.Movie.Runtime,
+			pq.Array(&item.Movie.Genres),
+		)
+		if err != nil {
+			return nil, err
+		}
+		item.Movie.ID = item.MovieID
+		items = append(items, &item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// GetAllForOwner returns the owner's lists without their items, newest first
+func (m *ListModel) GetAllForOwner(owner string) ([]*List, error) {
+	query := `
+    SELECT id, created_at, updated_at, coalesce(owner, ''), name, public, slug, version
+    FROM lists
+    WHERE owner = $1
+    ORDER BY created_at DESC, id DESC`
+
+	rows, err := m.DB.Query(query, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []*List{}
+	for rows.Next() {
+		var list List
+		err := rows.Scan(
+			&list.ID,
+			&list.CreatedAt,
+			&list.UpdatedAt,
+			&list.Owner,
+			&list.Name,
+			&list.Public,
+			&list.Slug,
+			&list.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, &list)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+// Update saves the name and visibility of a list
+func (m *ListModel) Update(list *List) error {
+	query := `
+    UPDATE lists
+    SET name = $1, public = $2, updated_at = NOW(), version = version + 1
+    WHERE id = $3 AND owner = $4
+    RETURNING updated_at, version`
+
+	err := m.DB.QueryRow(query, list.Name, list.Public, list.ID, list.Owner).Scan(&list.UpdatedAt, &list.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrorRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a list and all its items
+func (m *ListModel) Delete(id int64, owner string) error {
+	if id < 1 {
+		return ErrorRecordNotFound
+	}
+
+	result, err := m.DB.Exec(`DELETE FROM lists WHERE id = $1 AND owner = $2`, id, owner)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrorRecordNotFound
+	}
+	return nil
+}
+
+// AddItem puts a movie on a list at the given position, moving the items from
+// there on down by one. A position of 0 or past the end appends the movie
+func (m *ListModel) AddItem(listID int64, owner string, movieID int64, position int) (*ListItem, error) {
+	item := &ListItem{MovieID: movieID}
+
+	err := m.changeItems(listID, owner, func(tx *sql.Tx) error {
+		var exists, onList bool
+		err := tx.QueryRow(`
+        SELECT EXISTS (SELECT 1 FROM movies WHERE id = $2 AND deleted_at IS NULL),
+            EXISTS (SELECT 1 FROM list_items WHERE list_id = $1 AND movie_id = $2)`,
+			listID, movieID).Scan(&exists, &onList)
+		switch {
+		case err != nil:
+			return err
+		case !exists:
+			return ErrMovieNotFound
+		case onList:
+			return ErrDuplicateListItem
+		}
+
+		var stored int
+		stored, item.Position, err = listItems.makeRoom(tx, listID, position)
+		if err != nil {
+			return err
+		}
+		return tx.QueryRow(`
+        INSERT INTO list_items (list_id, movie_id, position)
+        VALUES ($1, $2, $3)
+        RETURNING added_at`, listID, movieID, stored).Scan(&item.AddedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// ListItemChange is what to change about a movie on a list
+type ListItemChange struct {
+	// Position moves the movie there if set, shifting the items in between by
+	// one. A position past the end moves it to the end
+	Position *int
+	// SetWatched marks the movie as watched on WatchedOn, or as not watched
+	// if that is nil
+	SetWatched bool
+	WatchedOn  *Date
+}
+
+// UpdateItem makes a change to a movie on a list. The whole change is made in
+// one transaction, so it either all happens or none of it does
+func (m *ListModel) UpdateItem(listID int64, owner string, movieID int64, change ListItemChange) error {
+	return m.changeItems(listID, owner, func(tx *sql.Tx) error {
+		if change.Position != nil {
+			if err := listItems.move(tx, listID, movieID, *change.Position); err != nil {
+				return err
+			}
+		}
+		if !change.SetWatched {
+			return nil
+		}
+
+		result, err := tx.Exec(`
+        UPDATE list_items SET watched_on = $3
+        WHERE list_id = $1 AND movie_id = $2`, listID, movieID, change.WatchedOn)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return ErrorRecordNotFound
+		}
+		return nil
+	})
+}
+
+// RemoveItem takes a movie off a list and closes the gap it leaves
+func (m *ListModel) RemoveItem(listID int64, owner string, movieID int64) error {
+	return m.changeItems(listID, owner, func(tx *sql.Tx) error {
+		return listItems.remove(tx, listID, movieID)
+	})
+}
+
+// changeItems() runs fn in a transaction holding a lock on the owner's list, so
+// changes to the order of one list happen one at a time. Missing rows are
+// reported as ErrorRecordNotFound
+func (m *ListModel) changeItems(listID int64, owner string, fn func(tx *sql.Tx) error) error {
+	err := withTx(m.DB, nil, func(tx *sql.Tx) error {
+		// updating the list row both checks the owner and takes the lock
+		err := tx.QueryRow(`
+        UPDATE lists SET updated_at = NOW(), version = version + 1
+        WHERE id = $1 AND owner = $2
+        RETURNING id`, listID, owner).Scan(&listID)
+		if err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrorRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+type MockListModel struct{}
+
+func (m MockListModel) Insert(list *List) error {
+	return nil
+}
+
+func (m MockListModel) Get(id int64, slug string, owner string) (*List, error) {
+	return nil, nil
+}
+
+func (m MockListModel) GetAllForOwner(owner string) ([]*List, error) {
+	return nil, nil
+}
+
+func (m MockListModel) Update(list *List) error {
+	return nil
+}
+
+func (m MockListModel) Delete(id int64, owner string) error {
+	return nil
+}
+
+func (m MockListModel) AddItem(listID int64, owner string, movieID int64, position int) (*ListItem, error) {
+	return nil, nil
+}
+
+func (m MockListModel) UpdateItem(listID int64, owner string, movieID int64, change ListItemChange) error {
+	return nil
+}
+
+func (m MockListModel) RemoveItem(listID int64, owner string, movieID int64) error {
+	return nil
+}
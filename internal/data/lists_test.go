@@ -0,0 +1,64 @@
+package data
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+func TestNewOwnerToken(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		token, owner, err := NewOwnerToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[token] {
+			t.Fatalf("token %q made twice", token)
+		}
+		seen[token] = true
+
+		v := validator.New()
+		if ValidateOwnerToken(v, token); !v.Valid() {
+			t.Errorf("token %q is not valid: %v", token, v.Errors)
+		}
+		if owner != ListOwner(token) {
+			t.Errorf("owner = %q; want ListOwner(token) = %q", owner, ListOwner(token))
+		}
+		if strings.Contains(owner, token) {
+			t.Errorf("owner %q gives away the token", owner)
+		}
+	}
+}
+
+func TestValidateOwnerToken(t *testing.T) {
+	tests := []struct {
+		token string
+		valid bool
+	}{
+		{"Y3FMKQ5D6ZXB2H4PNTRA7WCVJE", true},
+		{"", false},
+		{"Y3FMKQ5D6ZXB2H4PNTRA7WCVJ", false},
+		{"Y3FMKQ5D6ZXB2H4PNTRA7WCVJEX", false},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateOwnerToken(v, tt.token)
+		if v.Valid() != tt.valid {
+			t.Errorf("ValidateOwnerToken(%q) valid = %v; want %v", tt.token, v.Valid(), tt.valid)
+		}
+	}
+}
+
+func TestListJSONHidesOwner(t *testing.T) {
+	js, err := json.Marshal(&List{ID: 1, Owner: ListOwner("Y3FMKQ5D6ZXB2H4PNTRA7WCVJE"), Name: "Watchlist", Public: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(js), "owner") {
+		t.Errorf("list JSON %s includes the owner", js)
+	}
+}
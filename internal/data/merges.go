@@ -0,0 +1,248 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// MaxRuntimeTolerance is the largest difference in minutes between the
+// runtimes of two movies that GET /v1/movies/duplicates can be asked to allow
+const MaxRuntimeTolerance = 30
+
+// DuplicateMovie is one movie of a pair of probable duplicates
+type DuplicateMovie struct {
+	ID      int64    `json:"id"`
+	Title   string   `json:"title"`
+	Year    int32    `json:"year"`
+	Runtime Runtime  `json:"runtime"`
+	Genres  []string `json:"genres"`
+}
+
+// DuplicatePair is two movies with the same normalized title and year and
+// close runtimes. Movie is the one entered first, the natural one to keep
+type DuplicatePair struct {
+	Movie             DuplicateMovie `json:"movie"`
+	Duplicate         DuplicateMovie `json:"duplicate"`
+	RuntimeDifference int32          `json:"runtime_difference"`
+}
+
+// Duplicates returns up to limit pairs of movies outside the trash whose titles
+// match once normalized by movie_title_key(), from the same year and with
+// runtimes at most tolerance minutes apart
+func (m *MovieModel) Duplicates(tolerance, limit int) ([]*DuplicatePair, error) {
+	query := `
+    SELECT a.id, a.title, a.year, a.runtime, a.genres,
+        b.id, b.title, b.year, b.runtime, b.genres,
+        abs(a.runtime - b.runtime)
+    FROM movies a
+    JOIN movies b ON movie_title_key(b.title) = movie_title_key(a.title) AND b.year = a.year AND b.id > a.id
+    WHERE a.deleted_at IS NULL AND b.deleted_at IS NULL
+    AND abs(a.runtime - b.runtime) <= $1
+    ORDER BY a.id, b.id
+    LIMIT $2`
+
+	rows, err := m.conn().Query(query, tolerance, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pairs := []*DuplicatePair{}
+	for rows.Next() {
+		var pair DuplicatePair
+		err := rows.Scan(
+			&pair.Movie.ID, &pair.Movie.Title, &pair.Movie.Year, &pair.Movie.Runtime, pq.Array(&pair.Movie.Genres),
+			&pair.Duplicate.ID, &pair.Duplicate.Title, &pair.Duplicate.Year, &pair.Duplicate.Runtime, pq.Array(&pair.Duplicate.Genres),
+			&pair.RuntimeDifference,
+		)
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, &pair)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return pairs, nil
+}
+
+// Merge folds the duplicate into the survivor and deletes it. The survivor
+// takes over the duplicate's reviews, credits, places on lists and in
+// collections, relations, translations, releases and images, except where it
+// already has the same one, and gains its genres (up to the limit of 5) and
+// external ids. Its year is then that of the earliest of its releases. The
+// duplicate's id redirects to the survivor from then on, and its history is
+// kept under that id, ending with a merge revision. A missing survivor gives ErrorRecordNotFound and a missing
+// duplicate ErrMovieNotFound; movies in the trash count as missing
+func (m *MovieModel) Merge(survivorID, duplicateID int64) (*Movie, error) {
+	if survivorID < 1 {
+		return nil, ErrorRecordNotFound
+	}
+
+	var movie Movie
+	err := m.write(func(tx *sql.Tx) error {
+		// lock both movies, in id order like any other pair of writers would
+		rows, err := tx.Query(`
+        SELECT id FROM movies
+        WHERE id IN ($1, $2) AND deleted_at IS NULL
+        ORDER BY id
+        FOR UPDATE`, survivorID, duplicateID)
+		if err != nil {
+			return err
+		}
+		found := make(map[int64]bool)
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			found[id] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if !found[survivorID] {
+			return ErrorRecordNotFound
+		}
+		if !found[duplicateID] {
+			return ErrMovieNotFound
+		}
+
+		if err := mergeDependents(tx, duplicateID, survivorID); err != nil {
+			return err
+		}
+
+		// earlier redirects to the duplicate now go straight to the survivor
+		_, err = tx.Exec(`UPDATE movie_redirects SET target_id = $2 WHERE target_id = $1`, duplicateID, survivorID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO movie_redirects (movie_id, target_id) VALUES ($1, $2)`, duplicateID, survivorID)
+		if err != nil {
+			return err
+		}
+
+		// tell the revision trigger what kind of change this is, for the rest of
+		// the merge only; it records the duplicate's end as well as the survivor's
+		// new version
+		if _, err := tx.Exec(`SELECT set_config('greenlight.action', 'merge', true)`); err != nil {
+			return err
+		}
+
+		// delete the duplicate first, so its external ids are free for the survivor
+		var genres []string
+		var externalIDs ExternalIDs
+		var ratingCount, ratingSum int64
+		err = tx.QueryRow(`
+        DELETE FROM movies WHERE id = $1
+        RETURNING genres, external_ids, rating_count, rating_sum`, duplicateID).Scan(
+			pq.Array(&genres), &externalIDs, &ratingCount, &ratingSum)
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRow(`
+        UPDATE movies
+        SET genres = (genres || ARRAY(
+                SELECT g FROM unnest($2::text[]) WITH ORDINALITY AS d(g, n)
+                WHERE g <> ALL(genres) ORDER BY n
+            ))[1:5],
+            external_ids = $3::jsonb || external_ids,
+            year = COALESCE(`+fmt.Sprintf(releaseYearSQL, "$1")+`, year),
+            rating_count = rating_count + $4, rating_sum = rating_sum + $5,
+            version = version + 1
+        WHERE id = $1
+        RETURNING id, created_at, title, year, runtime, genres, version, average_rating, rating_count, external_ids`,
+			survivorID, pq.Array(genres), externalIDs, ratingCount, ratingSum,
+		).Scan(movieScanDest(&movie, movieAllColumns)...)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`SELECT set_config('greenlight.action', '', true)`)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &movie, nil
+}
+
+// mergeDependents() moves the rows that belong to one movie over to another,
+// dropping the ones the other movie already has an equivalent of
+func mergeDependents(tx *sql.Tx, fromID, toID int64) error {
+	statements := []string{
+		`UPDATE reviews SET movie_id = $2 WHERE movie_id = $1`,
+
+		`DELETE FROM credits d
+        WHERE d.movie_id = $1 AND EXISTS (
+            SELECT 1 FROM credits s
+            WHERE s.movie_id = $2 AND s.person_id = d.person_id AND s.role = d.role AND s.character = d.character
+        )`,
+		`UPDATE credits SET movie_id = $2 WHERE movie_id = $1`,
+
+		// a relation between the two would become a movie related to itself, and
+		// one to a movie the survivor is already related to would be a second edge
+		`DELETE FROM movie_relations WHERE (movie_id = $1 AND related_id = $2) OR (movie_id = $2 AND related_id = $1)`,
+		`DELETE FROM movie_relations d
+        WHERE $1 IN (d.movie_id, d.related_id) AND EXISTS (
+            SELECT 1 FROM movie_relations s
+            WHERE $2 IN (s.movie_id, s.related_id)
+            AND s.movie_id + s.related_id - $2 = d.movie_id + d.related_id - $1
+        )`,
+		`UPDATE movie_relations
+        SET movie_id = CASE WHEN movie_id = $1 THEN $2 ELSE movie_id END,
+            related_id = CASE WHEN related_id = $1 THEN $2 ELSE related_id END
+        WHERE $1 IN (movie_id, related_id)`,
+
+		`UPDATE movie_translations SET movie_id = $2
+        WHERE movie_id = $1 AND language NOT IN (SELECT language FROM movie_translations WHERE movie_id = $2)`,
+
+		`UPDATE movie_releases SET movie_id = $2
+        WHERE movie_id = $1 AND (country, type) NOT IN (SELECT country, type FROM movie_releases WHERE movie_id = $2)`,
+
+		`UPDATE movie_images SET movie_id = $2
+        WHERE movie_id = $1 AND hash NOT IN (SELECT hash FROM movie_images WHERE movie_id = $2)`,
+		// the images left are ones the survivor has too, so their files stay in use
+		`DELETE FROM movie_images WHERE movie_id = $1`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, fromID, toID); err != nil {
+			return err
+		}
+	}
+
+	for _, o := range []orderedMovies{listItems, collectionMovies} {
+		if err := o.repoint(tx, fromID, toID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MergedInto returns the id of the movie a merged movie now redirects to. An
+// id that was never merged, or whose movie is now in the trash, gives
+// ErrorRecordNotFound, as there is nothing to redirect to
+func (m *MovieModel) MergedInto(id int64) (int64, error) {
+	query := `
+    SELECT r.target_id
+    FROM movie_redirects r
+    JOIN movies ON movies.id = r.target_id AND movies.deleted_at IS NULL
+    WHERE r.movie_id = $1`
+
+	var targetID int64
+	err := m.conn().QueryRow(query, id).Scan(&targetID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrorRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+	return targetID, nil
+}
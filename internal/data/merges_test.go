@@ -0,0 +1,289 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// newTestTx() returns a transaction on the database named by
+// GREENLIGHT_TEST_DB_DSN, which must have the migrations applied. It is rolled
+// back when the test ends, so nothing a test writes is kept. Tests that need a
+// database are skipped when the variable isn't set
+func newTestTx(t *testing.T) *sql.Tx {
+	t.Helper()
+
+	dsn := os.Getenv("GREENLIGHT_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("GREENLIGHT_TEST_DB_DSN not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		db.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		tx.Rollback()
+		db.Close()
+	})
+	return tx
+}
+
+// testRow() runs an INSERT ... RETURNING id and returns the id
+func testRow(t *testing.T, tx *sql.Tx, query string, args ...interface{}) int64 {
+	t.Helper()
+
+	var id int64
+	if err := tx.QueryRow(query, args...).Scan(&id); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return id
+}
+
+func testMovie(t *testing.T, tx *sql.Tx, title string, genres ...string) int64 {
+	t.Helper()
+	if len(genres) == 0 {
+		genres = []string{"drama"}
+	}
+	return testRow(t, tx, `
+    INSERT INTO movies (title, year, runtime, genres)
+    VALUES ($1, 2000, 100, $2) RETURNING id`, title, pq.Array(genres))
+}
+
+// testOrder() puts movies in a list or collection in the order given
+func testOrder(t *testing.T, tx *sql.Tx, o orderedMovies, parentID int64, movieIDs ...int64) {
+	t.Helper()
+	for i, movieID := range movieIDs {
+		query := fmt.Sprintf(`INSERT INTO %s (%s, movie_id, position) VALUES ($1, $2, $3)`, o.table, o.parent)
+		if _, err := tx.Exec(query, parentID, movieID, i+1); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// orderOf() returns the movies of a list or collection in order, failing the
+// test if the positions don't run from 1 without gaps
+func orderOf(t *testing.T, tx *sql.Tx, o orderedMovies, parentID int64) []int64 {
+	t.Helper()
+
+	query := fmt.Sprintf(`SELECT movie_id, position FROM %s WHERE %s = $1 ORDER BY position`, o.table, o.parent)
+	rows, err := tx.Query(query, parentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var movieIDs []int64
+	for rows.Next() {
+		var movieID int64
+		var position int
+		if err := rows.Scan(&movieID, &position); err != nil {
+			t.Fatal(err)
+		}
+		if position != len(movieIDs)+1 {
+			t.Errorf("%s %d: movie %d at position %d; want %d", o.parentTable, parentID, movieID, position, len(movieIDs)+1)
+		}
+		movieIDs = append(movieIDs, movieID)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return movieIDs
+}
+
+func TestRepoint(t *testing.T) {
+	tx := newTestTx(t)
+
+	from := testMovie(t, tx, "Duplicate")
+	to := testMovie(t, tx, "Survivor")
+	other := testMovie(t, tx, "Other")
+
+	slug := fmt.Sprintf("repoint-%d", time.Now().UnixNano())
+	shared := testRow(t, tx, `INSERT INTO lists (name, slug) VALUES ('Shared', $1) RETURNING id`, slug+"-shared")
+	own := testRow(t, tx, `INSERT INTO lists (name, slug) VALUES ('Own', $1) RETURNING id`, slug+"-own")
+	sharedCollection := testRow(t, tx, `INSERT INTO collections (name) VALUES ('Shared') RETURNING id`)
+	ownCollection := testRow(t, tx, `INSERT INTO collections (name) VALUES ('Own') RETURNING id`)
+
+	testOrder(t, tx, listItems, shared, from, other, to)
+	testOrder(t, tx, listItems, own, other, from)
+	testOrder(t, tx, collectionMovies, sharedCollection, to, from, other)
+	testOrder(t, tx, collectionMovies, ownCollection, from)
+
+	for _, o := range []orderedMovies{listItems, collectionMovies} {
+		if err := o.repoint(tx, from, to); err != nil {
+			t.Fatalf("repoint %s: %v", o.table, err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		o        orderedMovies
+		parentID int64
+		want     []int64
+	}{
+		{"list with both drops the duplicate", listItems, shared, []int64{other, to}},
+		{"list with the duplicate gets the survivor", listItems, own, []int64{other, to}},
+		{"collection with both drops the duplicate", collectionMovies, sharedCollection, []int64{to, other}},
+		{"collection with the duplicate gets the survivor", collectionMovies, ownCollection, []int64{to}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := orderOf(t, tx, tt.o, tt.parentID); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeDependents(t *testing.T) {
+	tx := newTestTx(t)
+
+	from := testMovie(t, tx, "Duplicate")
+	to := testMovie(t, tx, "Survivor")
+	sequel := testMovie(t, tx, "Sequel")
+	remake := testMovie(t, tx, "Remake")
+	person := testRow(t, tx, `INSERT INTO people (name) VALUES ('Dwayne Johnson') RETURNING id`)
+
+	for _, credit := range []struct {
+		movieID   int64
+		role      string
+		character string
+	}{
+		{from, "actor", "Maui"},
+		{to, "actor", "Maui"},
+		{from, "director", ""},
+	} {
+		_, err := tx.Exec(`INSERT INTO credits (movie_id, person_id, role, character) VALUES ($1, $2, $3, $4)`,
+			credit.movieID, person, credit.role, credit.character)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, relation := range [][2]int64{{from, to}, {from, sequel}, {sequel, to}, {remake, from}} {
+		_, err := tx.Exec(`INSERT INTO movie_relations (movie_id, related_id, type) VALUES ($1, $2, 'sequel')`,
+			relation[0], relation[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := mergeDependents(tx, from, to); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("duplicate credit", func(t *testing.T) {
+		rows, err := tx.Query(`SELECT movie_id, role, character FROM credits WHERE person_id = $1 ORDER BY role`, person)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var got []string
+		for rows.Next() {
+			var movieID int64
+			var role, character string
+			if err := rows.Scan(&movieID, &role, &character); err != nil {
+				t.Fatal(err)
+			}
+			if movieID != to {
+				t.Errorf("%s credit left on movie %d", role, movieID)
+			}
+			got = append(got, role+" "+character)
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"actor Maui", "director "}; !slices.Equal(got, want) {
+			t.Errorf("got credits %q; want %q", got, want)
+		}
+	})
+
+	t.Run("shared relation", func(t *testing.T) {
+		var toSequel, toRemake, left int
+		err := tx.QueryRow(`
+        SELECT count(*) FILTER (WHERE $2 IN (movie_id, related_id) AND $3 IN (movie_id, related_id)),
+            count(*) FILTER (WHERE $2 IN (movie_id, related_id) AND $4 IN (movie_id, related_id)),
+            count(*) FILTER (WHERE $1 IN (movie_id, related_id))
+        FROM movie_relations
+        WHERE $2 IN (movie_id, related_id) OR $1 IN (movie_id, related_id)`,
+			from, to, sequel, remake).Scan(&toSequel, &toRemake, &left)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if toSequel != 1 {
+			t.Errorf("survivor related to the sequel %d times; want 1", toSequel)
+		}
+		if toRemake != 1 {
+			t.Errorf("survivor related to the remake %d times; want 1", toRemake)
+		}
+		if left != 0 {
+			t.Errorf("%d relations left on the duplicate", left)
+		}
+	})
+}
+
+func TestMerge(t *testing.T) {
+	tx := newTestTx(t)
+	m := MovieModel{tx: tx}
+
+	survivor := testMovie(t, tx, "Moana", "animation", "adventure")
+	duplicate := testMovie(t, tx, "Moana", "adventure", "comedy")
+	trashed := testMovie(t, tx, "Moana")
+	if _, err := tx.Exec(`UPDATE movies SET deleted_at = NOW() WHERE id = $1`, trashed); err != nil {
+		t.Fatal(err)
+	}
+
+	list := testRow(t, tx, `INSERT INTO lists (name, slug) VALUES ('Shared', $1) RETURNING id`,
+		fmt.Sprintf("merge-%d", time.Now().UnixNano()))
+	testOrder(t, tx, listItems, list, duplicate, survivor)
+
+	errorTests := []struct {
+		name                    string
+		survivorID, duplicateID int64
+		want                    error
+	}{
+		{"missing survivor", 0, duplicate, ErrorRecordNotFound},
+		{"trashed survivor", trashed, duplicate, ErrorRecordNotFound},
+		{"trashed duplicate", survivor, trashed, ErrMovieNotFound},
+	}
+
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := m.Merge(tt.survivorID, tt.duplicateID); !errors.Is(err, tt.want) {
+				t.Errorf("got %v; want %v", err, tt.want)
+			}
+		})
+	}
+
+	movie, err := m.Merge(survivor, duplicate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"animation", "adventure", "comedy"}; !slices.Equal(movie.Genres, want) {
+		t.Errorf("got genres %q; want %q", movie.Genres, want)
+	}
+	if got := orderOf(t, tx, listItems, list); !slices.Equal(got, []int64{survivor}) {
+		t.Errorf("got list %v; want %v", got, []int64{survivor})
+	}
+
+	target, err := m.MergedInto(duplicate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != survivor {
+		t.Errorf("duplicate redirects to %d; want %d", target, survivor)
+	}
+}
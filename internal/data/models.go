@@ -1,32 +1,280 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"time"
 )
 
 var ErrorRecordNotFound = errors.New("record not found")
 
+// ErrEditConflict is returned when a record changed between being read and
+// being updated, so the update would overwrite changes the writer hasn't seen
+var ErrEditConflict = errors.New("edit conflict")
+
+// ErrSavepointFailed is returned by Savepoint when the savepoint itself could
+// not be set, rolled back to or released, so the transaction can't carry on
+var ErrSavepointFailed = errors.New("savepoint failed")
+
 // Define Models struct which wraps all the database models
 type Models struct {
 	Movies interface {
 		Insert(movie *Movie) error
+		InsertMany(movies []*Movie) error
 		Get(id int64) (*Movie, error)
+		GetFields(id int64, fields []string) (*Movie, error)
 		Update(movie *Movie) error
 		Delete(id int64) error
+		GetTrash(pageSize int, cursor *Cursor) ([]*Movie, Metadata, error)
+		Restore(id int64) (*Movie, error)
+		Revert(id int64, version int32) (*Movie, error)
+		PurgeTrash(retention time.Duration) (int64, []*Image, error)
+		GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error)
+		StreamAll(title string, genres []string, filters Filters) (*MovieRows, error)
+		Export(ctx context.Context, filter ExportFilter, fn func(*Movie) error) error
+		SuggestTitles(prefix string, limit int) ([]*TitleMatch, error)
+		FindSimilarTitles(title string, limit int) ([]*TitleMatch, error)
+		SimilarTitlesFor(ids []int64, limit int) (map[int64][]*TitleMatch, error)
+		Facets(title string, genres []string, filters Filters, names []string) (*Facets, error)
+		GetByExternalID(source, id string) (*Movie, error)
+		Duplicates(tolerance, limit int) ([]*DuplicatePair, error)
+		Merge(survivorID, duplicateID int64) (*Movie, error)
+		MergedInto(id int64) (int64, error)
+	}
+	IdempotencyKeys interface {
+		Reserve(key string, fingerprint []byte, ttl, lease time.Duration) (*StoredResponse, error)
+		Complete(key string, response *StoredResponse) error
+		Release(key string) error
+		DeleteExpired() (int64, error)
+	}
+	Reviews interface {
+		Insert(review *Review) error
+		Get(movieID, id int64) (*Review, error)
+		GetAll(movieID int64, pageSize int, cursor *Cursor) ([]*Review, Metadata, error)
+		Update(review *Review) error
+		Delete(movieID, id int64) error
+	}
+	Genres interface {
+		Index() (*GenreIndex, error)
+		GetAll() ([]*Genre, error)
+		Get(slug string) (*Genre, error)
+		Insert(genre *Genre) error
+		Update(genre *Genre) error
+		Delete(slug string) error
+		Merge(from, into, actor string) (int64, error)
+	}
+	People interface {
+		Insert(person *Person) error
+		Get(id int64) (*Person, error)
+		GetAll(name string, pageSize int, cursor *Cursor) ([]*Person, Metadata, error)
+		Update(person *Person) error
+		Delete(id int64) error
+		AddCredit(credit *Credit) error
+		GetCredits(movieID int64) ([]*Credit, error)
+		CreditsFor(ids []int64) (map[int64][]*Credit, error)
+		DeleteCredit(movieID, id int64) error
+	}
+	Lists interface {
+		Insert(list *List) error
+		Get(id int64, slug string, owner string) (*List, error)
+		GetAllForOwner(owner string) ([]*List, error)
+		Update(list *List) error
+		Delete(id int64, owner string) error
+		AddItem(listID int64, owner string, movieID int64, position int) (*ListItem, error)
+		UpdateItem(listID int64, owner string, movieID int64, change ListItemChange) error
+		RemoveItem(listID int64, owner string, movieID int64) error
+	}
+	Collections interface {
+		Insert(collection *Collection) error
+		Get(id int64) (*Collection, error)
+		GetAll(pageSize int, cursor *Cursor) ([]*Collection, Metadata, error)
+		Update(collection *Collection) error
+		Delete(id int64) error
+		AddMovie(id, movieID int64, position int) (int, error)
+		MoveMovie(id, movieID int64, position int) error
+		RemoveMovie(id, movieID int64) error
+		SummaryFor(movieID int64) (*CollectionSummary, error)
+	}
+	Relations interface {
+		Insert(relation *Relation) error
+		Delete(movieID, id int64) error
+		Related(movieID int64, depth int) ([]*RelatedMovie, error)
 	}
+	Similarities interface {
+		Similar(movieID int64, limit int) ([]*SimilarMovie, error)
+		Refresh() error
+	}
+	Stats interface {
+		MovieStats(filter StatsFilter) (*MovieStats, error)
+	}
+	Translations interface {
+		GetAll(movieID int64) ([]*Translation, error)
+		Put(translation *Translation) (bool, error)
+		Delete(movieID int64, language string) error
+		Best(movieID int64, languages []string) (*Translation, error)
+		BestFor(ids []int64, languages []string) (map[int64]*Translation, error)
+	}
+	Releases interface {
+		GetAll(movieID int64) ([]*Release, error)
+		ReleasesFor(ids []int64) (map[int64][]*Release, error)
+		Insert(release *Release) error
+		Update(release *Release) error
+		Delete(movieID, id int64) error
+	}
+	Images interface {
+		Insert(image *Image, store func() error) error
+		GetAll(movieID int64) ([]*Image, error)
+		Delete(movieID, id int64) (*Image, error)
+		RemoveUnused(images []*Image, remove func(*Image) error) error
+	}
+	Revisions interface {
+		GetAll(movieID int64) ([]*Revision, error)
+		Get(movieID int64, version int32) (*Revision, error)
+		Previous(movieID int64, version int32) (*Revision, error)
+	}
+
+	db    *sql.DB
+	tx    *sql.Tx
+	actor string
 }
 
 // NewModels returns a Models struct with the real MovieModel
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Movies: &MovieModel{DB: db}, // use pointer to match method receivers
+		Movies:          &MovieModel{DB: db}, // use pointer to match method receivers
+		IdempotencyKeys: &IdempotencyModel{DB: db},
+		Reviews:         &ReviewModel{DB: db},
+		Genres:          &GenreModel{DB: db},
+		People:          &PersonModel{DB: db},
+		Lists:           &ListModel{DB: db},
+		Collections:     &CollectionModel{DB: db},
+		Relations:       &RelationModel{DB: db},
+		Similarities:    &SimilarityModel{DB: db},
+		Stats:           &StatsModel{DB: db},
+		Translations:    &TranslationModel{DB: db},
+		Releases:        &ReleaseModel{DB: db},
+		Images:          &ImageModel{DB: db},
+		Revisions:       &RevisionModel{DB: db},
+		db:              db,
+	}
+}
+
+// WithActor returns a copy of the models whose changes to movies (including
+// their year changing with their releases) are recorded in the revision
+// history as made by actor
+func (m Models) WithActor(actor string) Models {
+	// the mock models don't keep a history
+	if m.db == nil {
+		return m
+	}
+
+	m.actor = actor
+	m.Movies = &MovieModel{DB: m.db, tx: m.tx, actor: actor}
+	m.Releases = &ReleaseModel{DB: m.db, tx: m.tx, actor: actor}
+	return m
+}
+
+// Transaction runs fn with a copy of the models whose queries all go through a
+// single database transaction. The transaction is committed if fn returns nil
+// and rolled back otherwise. Idempotency keys, genres, people, lists,
+// collections, relations, similarities, stats, translations and images are
+// not part of the transaction
+func (m Models) Transaction(fn func(tx Models) error) error {
+	// the mock models have no database to begin a transaction on
+	if m.db == nil {
+		return fn(m)
+	}
+
+	return withTx(m.db, nil, func(tx *sql.Tx) error {
+		return fn(Models{
+			Movies:          &MovieModel{DB: m.db, tx: tx, actor: m.actor},
+			IdempotencyKeys: m.IdempotencyKeys,
+			Reviews:         &ReviewModel{DB: m.db, tx: tx},
+			Genres:          m.Genres,
+			People:          m.People,
+			Lists:           m.Lists,
+			Collections:     m.Collections,
+			Relations:       m.Relations,
+			Similarities:    m.Similarities,
+			Stats:           m.Stats,
+			Translations:    m.Translations,
+			Releases:        &ReleaseModel{DB: m.db, tx: tx, actor: m.actor},
+			Images:          m.Images,
+			Revisions:       &RevisionModel{DB: m.db, tx: tx},
+			db:              m.db,
+			tx:              tx,
+			actor:           m.actor,
+		})
+	})
+}
+
+// Savepoint runs fn so that if it fails only its own changes are rolled back
+// and the surrounding transaction can carry on. Outside a transaction it just calls fn
+func (m Models) Savepoint(fn func() error) error {
+	if m.tx == nil {
+		return fn()
+	}
+
+	if _, err := m.tx.Exec("SAVEPOINT models_savepoint"); err != nil {
+		return fmt.Errorf("%w: %w", ErrSavepointFailed, err)
+	}
+	if err := fn(); err != nil {
+		if _, rollbackErr := m.tx.Exec("ROLLBACK TO SAVEPOINT models_savepoint"); rollbackErr != nil {
+			return fmt.Errorf("%w: %w", ErrSavepointFailed, rollbackErr)
+		}
+		return err
+	}
+	if _, err := m.tx.Exec("RELEASE SAVEPOINT models_savepoint"); err != nil {
+		return fmt.Errorf("%w: %w", ErrSavepointFailed, err)
+	}
+	return nil
+}
+
+// querier is what the models need to run queries; both *sql.DB and *sql.Tx have it
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// withTx() runs fn in tx if there is one, leaving commit and rollback to its
+// owner. Otherwise it begins a transaction on db and commits it if fn succeeds
+func withTx(db *sql.DB, tx *sql.Tx, fn func(tx *sql.Tx) error) error {
+	if tx != nil {
+		return fn(tx)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	// rolling back after a successful commit does nothing
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
 	}
+	return tx.Commit()
 }
 
 // newMockModels returns a Models struct with the mock MovieModel
 func newMockModels() Models {
 	return Models{
-		Movies: MockMovieModel{},
+		Movies:          MockMovieModel{},
+		IdempotencyKeys: MockIdempotencyModel{},
+		Reviews:         MockReviewModel{},
+		Genres:          MockGenreModel{},
+		People:          MockPersonModel{},
+		Lists:           MockListModel{},
+		Collections:     MockCollectionModel{},
+		Relations:       MockRelationModel{},
+		Similarities:    MockSimilarityModel{},
+		Stats:           MockStatsModel{},
+		Translations:    MockTranslationModel{},
+		Releases:        MockReleaseModel{},
+		Images:          MockImageModel{},
+		Revisions:       MockRevisionModel{},
 	}
 }
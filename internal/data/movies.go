@@ -1,8 +1,12 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -10,32 +14,278 @@ import (
 )
 
 type Movie struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"-"` // Always hide
-	Title     string    `json:"title"`
-	Year      int32     `json:"year,omitempty"`    // Hide if empty
-	Runtime   Runtime   `json:"runtime,omitempty"` // Hide if empty
-	Genres    []string  `json:"genres,omitempty"`  // Hide if empty
-	Version   int32     `json:"version"`
+	ID        int64      `json:"id"`
+	CreatedAt time.Time  `json:"-"` // Always hide
+	Title     string     `json:"title"`
+	Year      int32      `json:"year,omitempty"`    // Hide if empty
+	Runtime   Runtime    `json:"runtime,omitempty"` // Hide if empty
+	Genres    []string   `json:"genres,omitempty"`  // Hide if empty
+	Version   int32      `json:"version"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // Only set for movies in the trash
+
+	// maintained by ReviewModel; AverageRating is nil until the first review
+	AverageRating *float64 `json:"average_rating"`
+	RatingCount   int32    `json:"rating_count"`
+
+	ExternalIDs ExternalIDs `json:"external_ids,omitempty"` // Hide if none
+}
+
+// GetAll returns one page of movies matching the title and genres filters,
+// using keyset pagination on the sort column with id as the tie-breaker
+func (m *MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+	rows, err := m.StreamAll(title, genres, filters)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+	for rows.Next() {
+		movies = append(movies, rows.Movie())
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return movies, rows.Metadata, nil
+}
+
+// StreamAll runs the same query as GetAll() but hands back the rows so they can
+// be written out one at a time. The pagination metadata is worked out in SQL and
+// is already available on the returned MovieRows before the first call to Next()
+func (m *MovieModel) StreamAll(title string, genres []string, filters Filters) (*MovieRows, error) {
+	column := filters.sortColumn()
+	fetchDirection, operator := filters.keysetClause()
+	displayDirection := filters.sortDirection()
+
+	args := append([]interface{}{title, pq.Array(genres), filters.PageSize, filters.PersonID}, filters.Release.args()...)
+
+	// only rows past the cursor are wanted when one was given
+	keyset := ""
+	if filters.Cursor != nil {
+		keyset = fmt.Sprintf("AND (%s, id) %s ($8, $9)", column, operator)
+		args = append(args, filters.Cursor.Value, filters.Cursor.ID)
+	}
+
+	// the sort column is needed for ordering even if the client didn't ask for it
+	columns := movieColumns(filters.Fields, column)
+	selected := strings.Join(columns, ", ")
+
+	// The innermost query reads one extra row (in fetch order, which is reversed
+	// when paging backward) to find out whether there is another page. The outer
+	// query drops that row, puts the page in display order and adds the number
+	// of rows fetched and the sort keys of the first and last rows to every row,
+	// and the ids of the whole page to the first
+	query := fmt.Sprintf(`
+    SELECT %[1]s, fetched,
+        first_value(%[3]s::text) OVER page, first_value(id) OVER page,
+        last_value(%[3]s::text) OVER page, last_value(id) OVER page,
+        CASE WHEN row_number() OVER page = 1 THEN array_agg(id) OVER page END
+    FROM (
+        SELECT fetched_rows.*,
+            count(*) OVER () AS fetched,
+            row_number() OVER (ORDER BY %[3]s %[4]s, id %[4]s) AS position
+        FROM (
+            SELECT %[1]s
+            FROM movies
+            WHERE deleted_at IS NULL
+            AND (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
+            AND (genres @> $2 OR $2 = '{}')
+            AND (id IN (SELECT movie_id FROM credits WHERE person_id = $4) OR $4 = 0)
+            %[6]s
+            %[2]s
+            ORDER BY %[3]s %[4]s, id %[4]s
+            LIMIT $3 + 1
+        ) fetched_rows
+    ) numbered_rows
+    WHERE position <= $3
+    WINDOW page AS (ORDER BY %[3]s %[5]s, id %[5]s ROWS BETWEEN UNBOUNDED PRECEDING AND UNBOUNDED FOLLOWING)
+    ORDER BY %[3]s %[5]s, id %[5]s`, selected, keyset, column, fetchDirection, displayDirection, releaseCondition(5))
+
+	rows, err := m.conn().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	movieRows := &MovieRows{
+		rows:     rows,
+		columns:  columns,
+		Metadata: Metadata{PageSize: filters.PageSize},
+	}
+
+	// read the first row straight away so the metadata is known up front. The
+	// caller never sees the rows if that fails, so they are closed here
+	if !movieRows.read() {
+		if err := movieRows.Err(); err != nil {
+			movieRows.Close()
+			return nil, err
+		}
+		return movieRows, nil
+	}
+
+	// there is a next page if more rows were read going forward, or if we came
+	// from it going backward; the same logic mirrored applies to the previous page
+	hasMore := movieRows.fetched > filters.PageSize
+	backward := filters.backward()
+	if hasMore || backward {
+		movieRows.Metadata.NextCursor = &Cursor{Sort: filters.Sort, Value: movieRows.lastKey, ID: movieRows.lastID}
+	}
+	if (hasMore && backward) || (filters.Cursor != nil && !backward) {
+		movieRows.Metadata.PrevCursor = &Cursor{Sort: filters.Sort, Value: movieRows.firstKey, ID: movieRows.firstID, Backward: true}
+	}
+
+	return movieRows, nil
+}
+
+// MovieRows is the result of StreamAll(). It is used like sql.Rows: call
+// Next() until it returns false, then check Err() and Close() it
+type MovieRows struct {
+	Metadata Metadata
+	// IDs holds the ids of every movie on the page, in order, so that what
+	// belongs with them can be loaded before the rows are read
+	IDs []int64
+
+	rows    *sql.Rows
+	columns []string
+	current *Movie
+	peeked  bool
+	err     error
+
+	// page details that are repeated on every row
+	fetched           int
+	firstKey, lastKey string
+	firstID, lastID   int64
+}
+
+// read() scans the next row into current
+func (r *MovieRows) read() bool {
+	if !r.rows.Next() {
+		return false
+	}
+
+	var movie Movie
+	var ids []int64
+	dest := append(movieScanDest(&movie, r.columns), &r.fetched, &r.firstKey, &r.firstID, &r.lastKey, &r.lastID, pq.Array(&ids))
+	if r.err = r.rows.Scan(dest...); r.err != nil {
+		return false
+	}
+	if ids != nil {
+		r.IDs = ids
+	}
+	r.current = &movie
+	r.peeked = true
+	return true
+}
+
+// Next() moves to the next movie, returning false when there are no more rows or an error happened
+func (r *MovieRows) Next() bool {
+	// the first row may already have been read by StreamAll()
+	if r.peeked {
+		r.peeked = false
+		return true
+	}
+	if r.err != nil || !r.read() {
+		return false
+	}
+	r.peeked = false
+	return true
+}
+
+// Movie() returns the current movie
+func (r *MovieRows) Movie() *Movie {
+	return r.current
+}
+
+// Err() returns the first error that happened while reading the rows
+func (r *MovieRows) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.rows.Err()
+}
+
+// Close() releases the underlying database rows
+func (r *MovieRows) Close() error {
+	return r.rows.Close()
+}
+
+// TitleMatch holds a movie title that is similar to a search term, along with
+// its pg_trgm similarity score (0 = nothing in common, 1 = identical)
+type TitleMatch struct {
+	ID         int64   `json:"id"`
+	Title      string  `json:"title"`
+	Year       int32   `json:"year,omitempty"`
+	Similarity float64 `json:"similarity"`
 }
 
 // Define a MovieModel struct which wraps a sql.DB connection pool
 type MovieModel struct {
-	DB *sql.DB
+	DB    *sql.DB
+	tx    *sql.Tx // set when the model belongs to Models.Transaction()
+	actor string  // who is making changes, recorded in the revision history
+}
+
+// write() runs fn in a transaction (the model's own, if it has one) after
+// passing the actor to the trigger that records movie revisions
+func (m *MovieModel) write(fn func(tx *sql.Tx) error) error {
+	err := withTx(m.DB, m.tx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`SELECT set_config('greenlight.actor', $1, true)`, m.actor)
+		if err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+	return duplicateExternalID(err)
+}
+
+// conn() returns the transaction the model runs in, or the connection pool
+func (m *MovieModel) conn() querier {
+	if m.tx != nil {
+		return m.tx
+	}
+	return m.DB
 }
 
 // The Insert() method accepts a pointer to a Movie struct, which contains the data for the new record.
 func (m *MovieModel) Insert(movie *Movie) error {
 	// SQL query for inserting and returning system-generated values
 	query := `
-    INSERT INTO movies (title, year, runtime, genres)
-    VALUES ($1, $2, $3, $4)
+    INSERT INTO movies (title, year, runtime, genres, external_ids)
+    VALUES ($1, $2, $3, $4, $5)
     RETURNING id, created_at, version`
 	// values for the placeholder taken from movie struct
 	// Stored in a slice to make it clear which values match which placeholders
-	args := []interface{}{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
+	args := []interface{}{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.ExternalIDs}
 	// execute the query and stored the returned value in the same movie struct
-	return m.DB.QueryRow(query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	return m.write(func(tx *sql.Tx) error {
+		return tx.QueryRow(query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	})
+}
+
+// InsertMany stores all the movies with a single COPY inside a transaction, so
+// either every movie is inserted or none are. Unlike Insert() the generated
+// id, created_at and version are not read back
+func (m *MovieModel) InsertMany(movies []*Movie) error {
+	return m.write(func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare(pq.CopyIn("movies", "title", "year", "runtime", "genres", "external_ids"))
+		if err != nil {
+			return err
+		}
+
+		// each Exec() queues a row; the final Exec() without arguments sends them
+		for _, movie := range movies {
+			_, err = stmt.Exec(movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.ExternalIDs)
+			if err != nil {
+				stmt.Close()
+				return err
+			}
+		}
+		if _, err = stmt.Exec(); err != nil {
+			stmt.Close()
+			return err
+		}
+		return stmt.Close()
+	})
 }
 
 func (m *MovieModel) Get(id int64) (*Movie, error) {
@@ -46,15 +296,15 @@ func (m *MovieModel) Get(id int64) (*Movie, error) {
 
 	// SQL query to retrieve the movie
 	query := `
-    SELECT id, created_at, title, year, runtime, genres, version
+    SELECT id, created_at, title, year, runtime, genres, version, average_rating, rating_count, external_ids
     FROM movies
-    WHERE id = $1`
+    WHERE id = $1 AND deleted_at IS NULL`
 
 	// create a movie struct to store the result
 	var movie Movie
 
 	// run the query with QueryRow() and scan the result into the Movie struct
-	err := m.DB.QueryRow(query, id).Scan(
+	err := m.conn().QueryRow(query, id).Scan(
 		&movie.ID,
 		&movie.CreatedAt,
 		&movie.Title,
@@ -63,6 +313,9 @@ func (m *MovieModel) Get(id int64) (*Movie, error) {
 		// pq.Array() acts as an adapter that helps Go read PostgreSQL arrays into Go slices.
 		pq.Array(&movie.Genres),
 		&movie.Version,
+		&movie.AverageRating,
+		&movie.RatingCount,
+		&movie.ExternalIDs,
 	)
 	// handles error
 	if err != nil {
@@ -77,13 +330,40 @@ func (m *MovieModel) Get(id int64) (*Movie, error) {
 	return &movie, nil
 }
 
+// GetFields works like Get() but only selects the requested fields (and id)
+func (m *MovieModel) GetFields(id int64, fields []string) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrorRecordNotFound
+	}
+
+	columns := movieColumns(fields)
+	query := fmt.Sprintf(`
+    SELECT %s
+    FROM movies
+    WHERE id = $1 AND deleted_at IS NULL`, strings.Join(columns, ", "))
+
+	var movie Movie
+	err := m.conn().QueryRow(query, id).Scan(movieScanDest(&movie, columns)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &movie, nil
+}
+
 func (m *MovieModel) Update(movie *Movie) error {
-	// SQL query to update the movie and return the new version number
+	// SQL query to update the movie and return the new version number (movies in the trash can't be updated).
+	// A movie with releases keeps the year of the earliest one, whatever year is given
 	query := `
     UPDATE movies
-    SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
-    WHERE id = $5
-    RETURNING version`
+    SET title = $1, year = COALESCE(` + fmt.Sprintf(releaseYearSQL, "$6") + `, $2), runtime = $3, genres = $4,
+        external_ids = $5, version = version + 1
+    WHERE id = $6 AND deleted_at IS NULL
+    RETURNING version, year`
 
 	// values for the placeholder
 	args := []interface{}{
@@ -91,35 +371,54 @@ func (m *MovieModel) Update(movie *Movie) error {
 		movie.Year,
 		movie.Runtime,
 		pq.Array(movie.Genres),
+		movie.ExternalIDs,
 		movie.ID,
 	}
 
 	// Execute the query, then scan the new version into movie.Version
-	return m.DB.QueryRow(query, args...).Scan(&movie.Version)
+	err := m.write(func(tx *sql.Tx) error {
+		return tx.QueryRow(query, args...).Scan(&movie.Version, &movie.Year)
+	})
+	if err != nil {
+		switch {
+		// the movie was moved to the trash after it was read
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrorRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
 }
 
+// Delete moves the movie to the trash; it can be restored until it is purged
 func (m *MovieModel) Delete(id int64) error {
 	// Return ErrRecordNotFound if the ID is invalid.
 	if id < 1 {
 		return ErrorRecordNotFound
 	}
 
-	// SQL query to delete the record
-	query := `DELETE FROM movies WHERE id = $1`
+	// SQL query to mark the record as deleted; like any other change it is a new version
+	query := `
+    UPDATE movies
+    SET deleted_at = NOW(), version = version + 1
+    WHERE id = $1 AND deleted_at IS NULL`
 
-	// Execute the query ( Exec() gives a sql.Result object, which tells us how many rows were affected )
-	result, err := m.DB.Exec(query, id)
-	if err != nil {
+	// Execute the query and check how many rows were affected
+	var rowsAffected int64
+	err := m.write(func(tx *sql.Tx) error {
+		result, err := tx.Exec(query, id)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err = result.RowsAffected()
 		return err
-	}
-
-	// Check how many rows were affected
-	rowsAffected, err := result.RowsAffected()
+	})
 	if err != nil {
 		return err
 	}
 
-	// If no rows were affected, the movie didn't exist
+	// If no rows were affected, the movie didn't exist (or was already in the trash)
 	if rowsAffected == 0 {
 		return ErrorRecordNotFound
 	}
@@ -127,16 +426,305 @@ func (m *MovieModel) Delete(id int64) error {
 	return nil
 }
 
+// TrashSort is the Sort of the cursors GetTrash() pages with
+const TrashSort = "-deleted_at"
+
+// GetTrash returns a page of the movies in the trash, most recently deleted
+// first, starting after the cursor (or from the start if it is nil)
+func (m *MovieModel) GetTrash(pageSize int, cursor *Cursor) ([]*Movie, Metadata, error) {
+	backward := cursor != nil && cursor.Backward
+
+	// one more than a page is read to tell whether there is another page
+	comparison, direction := "<", "DESC"
+	if backward {
+		comparison, direction = ">", "ASC"
+	}
+	query := fmt.Sprintf(`
+    SELECT id, created_at, title, year, runtime, genres, version, average_rating, rating_count, external_ids, deleted_at
+    FROM movies
+    WHERE deleted_at IS NOT NULL AND ($2::bigint IS NULL OR (deleted_at, id) %s ($3::timestamptz, $2))
+    ORDER BY deleted_at %[2]s, id %[2]s
+    LIMIT $1`, comparison, direction)
+
+	var cursorID *int64
+	var cursorDeletedAt *string
+	if cursor != nil {
+		cursorID, cursorDeletedAt = &cursor.ID, &cursor.Value
+	}
+
+	rows, err := m.conn().Query(query, pageSize+1, cursorID, cursorDeletedAt)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+	for rows.Next() {
+		var movie Movie
+		dest := append(movieScanDest(&movie, movieAllColumns), &movie.DeletedAt)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, Metadata{}, err
+		}
+		movies = append(movies, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	hasMore := len(movies) > pageSize
+	if hasMore {
+		movies = movies[:pageSize]
+	}
+	if backward {
+		slices.Reverse(movies)
+	}
+
+	var first, last *Cursor
+	if len(movies) > 0 {
+		first, last = trashCursor(movies[0]), trashCursor(movies[len(movies)-1])
+	}
+	return movies, pageMetadata(pageSize, cursor, hasMore, first, last), nil
+}
+
+// trashCursor() returns the cursor for a movie in the trash
+func trashCursor(movie *Movie) *Cursor {
+	return &Cursor{Sort: TrashSort, Value: movie.DeletedAt.Format(time.RFC3339Nano), ID: movie.ID}
+}
+
+// Restore takes a movie out of the trash, counting it as a new version
+func (m *MovieModel) Restore(id int64) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrorRecordNotFound
+	}
+
+	query := `
+    UPDATE movies
+    SET deleted_at = NULL, version = version + 1
+    WHERE id = $1 AND deleted_at IS NOT NULL
+    RETURNING id, created_at, title, year, runtime, genres, version, average_rating, rating_count, external_ids`
+
+	var movie Movie
+	err := m.write(func(tx *sql.Tx) error {
+		return tx.QueryRow(query, id).Scan(movieScanDest(&movie, movieAllColumns)...)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &movie, nil
+}
+
+// Revert makes an earlier version of a movie the current one again. The old
+// values are written as a new version, so the history in between is kept
+func (m *MovieModel) Revert(id int64, version int32) (*Movie, error) {
+	if id < 1 || version < 1 {
+		return nil, ErrorRecordNotFound
+	}
+
+	// the revision snapshot is turned back into a movies row to read its columns;
+	// snapshots from before external ids were added leave them as they are, and
+	// a movie with releases keeps the year of the earliest one
+	query := `
+    UPDATE movies
+    SET title = old.title, year = COALESCE(` + fmt.Sprintf(releaseYearSQL, "movies.id") + `, old.year), runtime = old.runtime, genres = old.genres,
+        external_ids = COALESCE(old.external_ids, movies.external_ids), version = movies.version + 1
+    FROM movie_revisions r, jsonb_populate_record(NULL::movies, r.snapshot) old
+    WHERE movies.id = $1 AND movies.deleted_at IS NULL
+    AND r.movie_id = $1 AND r.version = $2
+    RETURNING movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres, movies.version,
+        movies.average_rating, movies.rating_count, movies.external_ids`
+
+	var movie Movie
+	err := m.write(func(tx *sql.Tx) error {
+		// tell the revision trigger what kind of change this is, for this statement only
+		if _, err := tx.Exec(`SELECT set_config('greenlight.action', 'revert', true)`); err != nil {
+			return err
+		}
+		if err := tx.QueryRow(query, id, version).Scan(movieScanDest(&movie, movieAllColumns)...); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`SELECT set_config('greenlight.action', '', true)`)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &movie, nil
+}
+
+// PurgeTrash permanently deletes movies that have been in the trash for longer
+// than the retention period and returns how many were removed, along with
+// their images so the files can be passed to ImageModel.RemoveUnused
+func (m *MovieModel) PurgeTrash(retention time.Duration) (int64, []*Image, error) {
+	var purged int64
+	var images []*Image
+	// the delete is recorded as a purge revision, which outlives the movie
+	err := m.write(func(tx *sql.Tx) error {
+		// lock the movies first, so one restored meanwhile keeps its images
+		rows, err := tx.Query(`
+        SELECT id FROM movies
+        WHERE deleted_at < NOW() - $1 * INTERVAL '1 second'
+        FOR UPDATE`, int64(retention.Seconds()))
+		if err != nil {
+			return err
+		}
+		ids := []int64{}
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// the cascade would delete the images too, but without saying which
+		images, err = queryImages(tx, `
+        DELETE FROM movie_images WHERE movie_id = ANY($1)
+        RETURNING id, movie_id, created_at, kind, hash, content_type, width, height, size, thumbnails`, pq.Array(ids))
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.Exec(`DELETE FROM movies WHERE id = ANY($1)`, pq.Array(ids))
+		if err != nil {
+			return err
+		}
+		purged, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return purged, images, nil
+}
+
+// SuggestTitles returns up to limit titles for typeahead, ranking titles that
+// start with the prefix first and then by trigram word similarity
+func (m *MovieModel) SuggestTitles(prefix string, limit int) ([]*TitleMatch, error) {
+	// <% matches when the prefix is similar to any part of the title, so typos
+	// still get results. It uses the trigram index and the LIKE uses the
+	// lower(title) text_pattern_ops one
+	query := `
+    SELECT id, title, year, word_similarity($1, title) AS score
+    FROM movies
+    WHERE deleted_at IS NULL AND ($1 <% title OR lower(title) LIKE $3 ESCAPE '\')
+    ORDER BY lower(title) LIKE $3 ESCAPE '\' DESC, score DESC, title
+    LIMIT $2`
+
+	return m.queryTitleMatches(query, prefix, limit, strings.ToLower(likeEscaper.Replace(prefix))+"%")
+}
+
+// FindSimilarTitles returns up to limit existing movies whose whole title is
+// similar to the given one, which is used to warn about probable duplicates
+func (m *MovieModel) FindSimilarTitles(title string, limit int) ([]*TitleMatch, error) {
+	// % uses the pg_trgm.similarity_threshold setting (0.3 by default)
+	query := `
+    SELECT id, title, year, similarity(title, $1) AS score
+    FROM movies
+    WHERE deleted_at IS NULL AND title % $1
+    ORDER BY score DESC, id
+    LIMIT $2`
+
+	return m.queryTitleMatches(query, title, limit)
+}
+
+// SimilarTitlesFor returns, for each of the given movies, up to limit other
+// movies with a similar title in a single query
+func (m *MovieModel) SimilarTitlesFor(ids []int64, limit int) (map[int64][]*TitleMatch, error) {
+	query := `
+    SELECT m.id, s.id, s.title, s.year, s.score
+    FROM movies m
+    CROSS JOIN LATERAL (
+        SELECT o.id, o.title, o.year, similarity(o.title, m.title) AS score
+        FROM movies o
+        WHERE o.id <> m.id AND o.deleted_at IS NULL AND o.title % m.title
+        ORDER BY score DESC, o.id
+        LIMIT $2
+    ) s
+    WHERE m.id = ANY($1)
+    ORDER BY m.id, s.score DESC`
+
+	rows, err := m.conn().Query(query, pq.Array(ids), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := make(map[int64][]*TitleMatch)
+	for rows.Next() {
+		var movieID int64
+		var match TitleMatch
+		err := rows.Scan(&movieID, &match.ID, &match.Title, &match.Year, &match.Similarity)
+		if err != nil {
+			return nil, err
+		}
+		matches[movieID] = append(matches[movieID], &match)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return matches, nil
+}
+
+// queryTitleMatches runs one of the title similarity queries and scans the rows
+func (m *MovieModel) queryTitleMatches(query string, args ...interface{}) ([]*TitleMatch, error) {
+	rows, err := m.conn().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	// make sure the result set is closed before returning
+	defer rows.Close()
+
+	matches := []*TitleMatch{}
+	for rows.Next() {
+		var match TitleMatch
+		err := rows.Scan(&match.ID, &match.Title, &match.Year, &match.Similarity)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, &match)
+	}
+	// check for errors that happened during iteration
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return matches, nil
+}
+
 type MockMovieModel struct{}
 
 func (m MockMovieModel) Insert(movie *Movie) error {
 	return nil
 }
 
+func (m MockMovieModel) InsertMany(movies []*Movie) error {
+	return nil
+}
+
 func (m MockMovieModel) Get(id int64) (*Movie, error) {
 	return nil, nil
 }
 
+func (m MockMovieModel) GetFields(id int64, fields []string) (*Movie, error) {
+	return nil, nil
+}
+
 func (m MockMovieModel) Update(movie *Movie) error {
 	return nil
 }
@@ -145,17 +733,93 @@ func (m MockMovieModel) Delete(id int64) error {
 	return nil
 }
 
-// collect the movie validation rules in ValidateMovie() function for reusing
-func ValidateMovie(v *validator.Validator, movie *Movie) {
+func (m MockMovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+	return nil, Metadata{}, nil
+}
+
+func (m MockMovieModel) StreamAll(title string, genres []string, filters Filters) (*MovieRows, error) {
+	return nil, nil
+}
+
+func (m MockMovieModel) Export(ctx context.Context, filter ExportFilter, fn func(*Movie) error) error {
+	return nil
+}
+
+func (m MockMovieModel) GetTrash(pageSize int, cursor *Cursor) ([]*Movie, Metadata, error) {
+	return nil, Metadata{}, nil
+}
+
+func (m MockMovieModel) Restore(id int64) (*Movie, error) {
+	return nil, nil
+}
+
+func (m MockMovieModel) Revert(id int64, version int32) (*Movie, error) {
+	return nil, nil
+}
+
+func (m MockMovieModel) PurgeTrash(retention time.Duration) (int64, []*Image, error) {
+	return 0, nil, nil
+}
+
+func (m MockMovieModel) SuggestTitles(prefix string, limit int) ([]*TitleMatch, error) {
+	return nil, nil
+}
+
+func (m MockMovieModel) FindSimilarTitles(title string, limit int) ([]*TitleMatch, error) {
+	return nil, nil
+}
+
+func (m MockMovieModel) SimilarTitlesFor(ids []int64, limit int) (map[int64][]*TitleMatch, error) {
+	return nil, nil
+}
+
+func (m MockMovieModel) Facets(title string, genres []string, filters Filters, names []string) (*Facets, error) {
+	return nil, nil
+}
+
+func (m MockMovieModel) GetByExternalID(source, id string) (*Movie, error) {
+	return nil, nil
+}
+
+func (m MockMovieModel) Duplicates(tolerance, limit int) ([]*DuplicatePair, error) {
+	return nil, nil
+}
+
+func (m MockMovieModel) Merge(survivorID, duplicateID int64) (*Movie, error) {
+	return nil, nil
+}
+
+func (m MockMovieModel) MergedInto(id int64) (int64, error) {
+	return 0, ErrorRecordNotFound
+}
+
+// collect the movie validation rules in ValidateMovie() function for reusing.
+// Genres are checked against the index and replaced by their slugs; with a nil
+// index any genre is accepted as it is
+func ValidateMovie(v *validator.Validator, movie *Movie, genres *GenreIndex) {
 	v.Check(movie.Title != "", "title", "must be provided")
 	v.Check(len(movie.Title) <= 500, "title", "must not be more than 500 bytes long")
 	v.Check(movie.Year != 0, "year", "must be provided")
 	v.Check(movie.Year >= 1888, "year", "must be greater than 1888")
-	v.Check(movie.Year <= int32(time.Now().Year()), "year", "must not be in the future")
+	v.Check(movie.Year <= int32(time.Now().Year()+releaseYearsAhead), "year", fmt.Sprintf("must not be more than %d years ahead", releaseYearsAhead))
 	v.Check(movie.Runtime != 0, "runtime", "must be provided")
 	v.Check(movie.Runtime > 0, "runtime", "must be a positive integer")
 	v.Check(movie.Genres != nil, "genres", "must be provided")
 	v.Check(len(movie.Genres) >= 1, "genres", "must contain at least 1 genre")
 	v.Check(len(movie.Genres) <= 5, "genres", "must not contain more than 5 genres")
+
+	// resolve before checking for duplicates, so "Sci-Fi" and "Science Fiction" count as one
+	if genres != nil {
+		for i, name := range movie.Genres {
+			slug, ok := genres.Resolve(name)
+			if !ok {
+				v.AddError("genres", fmt.Sprintf("unknown genre %q", name))
+				continue
+			}
+			movie.Genres[i] = slug
+		}
+	}
 	v.Check(validator.Unique(movie.Genres), "genres", "must not contain duplicate values")
+
+	ValidateExternalIDs(v, movie.ExternalIDs)
 }
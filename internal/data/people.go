@@ -0,0 +1,388 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+var (
+	// ErrDuplicateCredit is returned when the same credit is added to a movie twice
+	ErrDuplicateCredit = errors.New("duplicate credit")
+	// ErrPersonNotFound is returned when a credit refers to a person that doesn't exist
+	ErrPersonNotFound = errors.New("person not found")
+)
+
+// CreditRoles holds the roles a person can be credited with
+var CreditRoles = []string{"actor", "director", "writer"}
+
+type Person struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	Name      string    `json:"name"`
+	BirthYear int32     `json:"birth_year,omitempty"` // Hide if unknown
+	Version   int32     `json:"version"`
+	Credits   []*Credit `json:"credits,omitempty"`
+}
+
+// Credit is a person's part in a movie. Character is only used for actors;
+// BillingOrder puts the cast in order, lowest first, with 0 meaning unbilled
+type Credit struct {
+	ID           int64  `json:"id"`
+	MovieID      int64  `json:"movie_id"`
+	PersonID     int64  `json:"person_id"`
+	Role         string `json:"role"`
+	Character    string `json:"character,omitempty"`
+	BillingOrder int32  `json:"billing_order,omitempty"`
+
+	// filled in when credits are listed for a movie or for a person
+	PersonName string `json:"person_name,omitempty"`
+	MovieTitle string `json:"movie_title,omitempty"`
+}
+
+func ValidatePerson(v *validator.Validator, person *Person) {
+	v.Check(person.Name != "", "name", "must be provided")
+	v.Check(len(person.Name) <= 500, "name", "must not be more than 500 bytes long")
+	if person.BirthYear != 0 {
+		v.Check(person.BirthYear >= 1800, "birth_year", "must be greater than 1800")
+		v.Check(person.BirthYear <= int32(time.Now().Year()), "birth_year", "must not be in the future")
+	}
+}
+
+func ValidateCredit(v *validator.Validator, credit *Credit) {
+	v.Check(credit.PersonID > 0, "person_id", "must be a positive integer")
+	v.Check(validator.In(credit.Role, CreditRoles...), "role", "must be one of actor, director or writer")
+	v.Check(len(credit.Character) <= 500, "character", "must not be more than 500 bytes long")
+	if credit.Role != "actor" {
+		v.Check(credit.Character == "", "character", "must only be provided for actors")
+	}
+	v.Check(credit.BillingOrder >= 0, "billing_order", "must not be negative")
+}
+
+// Define a PersonModel struct which wraps a sql.DB connection pool. It looks
+// after people and their credits on movies
+type PersonModel struct {
+	DB *sql.DB
+}
+
+func (m *PersonModel) Insert(person *Person) error {
+	query := `
+    INSERT INTO people (name, birth_year)
+    VALUES ($1, NULLIF($2, 0))
+    RETURNING id, created_at, version`
+
+	return m.DB.QueryRow(query, person.Name, person.BirthYear).Scan(&person.ID, &person.CreatedAt, &person.Version)
+}
+
+// Get returns a person along with their credits, newest movies first
+func (m *PersonModel) Get(id int64) (*Person, error) {
+	if id < 1 {
+		return nil, ErrorRecordNotFound
+	}
+
+	query := `
+    SELECT id, created_at, name, COALESCE(birth_year, 0), version
+    FROM people
+    WHERE id = $1`
+
+	var person Person
+	err := m.DB.QueryRow(query, id).Scan(&person.ID, &person.CreatedAt, &person.Name, &person.BirthYear, &person.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	query = `
+    SELECT c.id, c.movie_id, c.person_id, c.role, c.character, c.billing_order, m.title
+    FROM credits c
+    JOIN movies m ON m.id = c.movie_id
+    WHERE c.person_id = $1 AND m.deleted_at IS NULL
+    ORDER BY m.year DESC, m.id, c.role`
+
+	person.Credits, err = m.queryCredits(query, id, false)
+	if err != nil {
+		return nil, err
+	}
+	return &person, nil
+}
+
+// likeEscaper escapes the characters that have a special meaning in a LIKE
+// pattern, so a search term matches only itself
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// PersonSort is the Sort of the cursors GetAll() pages people with
+const PersonSort = "name"
+
+// GetAll returns a page of the people whose name contains the given text (or
+// everyone if it is empty), in name order, starting after the cursor (or from
+// the start if it is nil)
+func (m *PersonModel) GetAll(name string, pageSize int, cursor *Cursor) ([]*Person, Metadata, error) {
+	backward := cursor != nil && cursor.Backward
+
+	// one more than a page is read to tell whether there is another page
+	comparison, direction := ">", "ASC"
+	if backward {
+		comparison, direction = "<", "DESC"
+	}
+	query := fmt.Sprintf(`
+    SELECT id, created_at, name, COALESCE(birth_year, 0), version
+    FROM people
+    WHERE (name ILIKE '%%' || $1 || '%%' ESCAPE '\' OR $1 = '')
+    AND ($3::bigint IS NULL OR (name, id) %s ($4, $3))
+    ORDER BY name %[2]s, id %[2]s
+    LIMIT $2`, comparison, direction)
+
+	var cursorID *int64
+	var cursorName string
+	if cursor != nil {
+		cursorID, cursorName = &cursor.ID, cursor.Value
+	}
+
+	rows, err := m.DB.Query(query, likeEscaper.Replace(name), pageSize+1, cursorID, cursorName)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	people := []*Person{}
+	for rows.Next() {
+		var person Person
+		err := rows.Scan(&person.ID, &person.CreatedAt, &person.Name, &person.BirthYear, &person.Version)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		people = append(people, &person)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	hasMore := len(people) > pageSize
+	if hasMore {
+		people = people[:pageSize]
+	}
+	if backward {
+		slices.Reverse(people)
+	}
+
+	var first, last *Cursor
+	if len(people) > 0 {
+		first, last = personCursor(people[0]), personCursor(people[len(people)-1])
+	}
+	return people, pageMetadata(pageSize, cursor, hasMore, first, last), nil
+}
+
+// personCursor() returns the cursor for a person
+func personCursor(person *Person) *Cursor {
+	return &Cursor{Sort: PersonSort, Value: person.Name, ID: person.ID}
+}
+
+func (m *PersonModel) Update(person *Person) error {
+	query := `
+    UPDATE people
+    SET name = $1, birth_year = NULLIF($2, 0), version = version + 1
+    WHERE id = $3
+    RETURNING version`
+
+	err := m.DB.QueryRow(query, person.Name, person.BirthYear, person.ID).Scan(&person.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrorRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a person and all their credits
+func (m *PersonModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrorRecordNotFound
+	}
+
+	result, err := m.DB.Exec(`DELETE FROM people WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrorRecordNotFound
+	}
+	return nil
+}
+
+// AddCredit attaches a person to a movie. A movie in the trash gives
+// ErrorRecordNotFound and a person that doesn't exist gives ErrPersonNotFound
+func (m *PersonModel) AddCredit(credit *Credit) error {
+	query := `
+    INSERT INTO credits (movie_id, person_id, role, character, billing_order)
+    SELECT id, $2, $3, $4, $5
+    FROM movies
+    WHERE id = $1 AND deleted_at IS NULL
+    RETURNING id`
+
+	args := []interface{}{credit.MovieID, credit.PersonID, credit.Role, credit.Character, credit.BillingOrder}
+
+	err := m.DB.QueryRow(query, args...).Scan(&credit.ID)
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrorRecordNotFound
+		case errors.As(err, &pqErr) && pqErr.Code == "23503":
+			return ErrPersonNotFound
+		case errors.As(err, &pqErr) && pqErr.Code == "23505":
+			return ErrDuplicateCredit
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// GetCredits returns the credits of a movie: directors, then writers, then the
+// cast in billing order
+func (m *PersonModel) GetCredits(movieID int64) ([]*Credit, error) {
+	query := `
+    SELECT c.id, c.movie_id, c.person_id, c.role, c.character, c.billing_order, p.name
+    FROM credits c
+    JOIN people p ON p.id = c.person_id
+    WHERE c.movie_id = $1
+    ORDER BY array_position(ARRAY['director', 'writer', 'actor'], c.role),
+        c.billing_order = 0, c.billing_order, p.name`
+
+	return m.queryCredits(query, movieID, true)
+}
+
+// CreditsFor returns the credits of each of the movies, in the same order as
+// GetCredits(), keyed by movie id
+func (m *PersonModel) CreditsFor(ids []int64) (map[int64][]*Credit, error) {
+	query := `
+    SELECT c.id, c.movie_id, c.person_id, c.role, c.character, c.billing_order, p.name
+    FROM credits c
+    JOIN people p ON p.id = c.person_id
+    WHERE c.movie_id = ANY($1)
+    ORDER BY c.movie_id, array_position(ARRAY['director', 'writer', 'actor'], c.role),
+        c.billing_order = 0, c.billing_order, p.name`
+
+	rows, err := m.DB.Query(query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := make(map[int64][]*Credit, len(ids))
+	for rows.Next() {
+		var credit Credit
+		err := rows.Scan(&credit.ID, &credit.MovieID, &credit.PersonID, &credit.Role, &credit.Character, &credit.BillingOrder, &credit.PersonName)
+		if err != nil {
+			return nil, err
+		}
+		credits[credit.MovieID] = append(credits[credit.MovieID], &credit)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return credits, nil
+}
+
+// DeleteCredit removes a credit from a movie
+func (m *PersonModel) DeleteCredit(movieID, id int64) error {
+	if id < 1 {
+		return ErrorRecordNotFound
+	}
+
+	result, err := m.DB.Exec(`DELETE FROM credits WHERE id = $1 AND movie_id = $2`, id, movieID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrorRecordNotFound
+	}
+	return nil
+}
+
+// queryCredits() runs a credits query whose last column is the person's name
+// when listing a movie's credits, or the movie's title when listing a person's
+func (m *PersonModel) queryCredits(query string, id int64, forMovie bool) ([]*Credit, error) {
+	rows, err := m.DB.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := []*Credit{}
+	for rows.Next() {
+		var credit Credit
+		name := &credit.MovieTitle
+		if forMovie {
+			name = &credit.PersonName
+		}
+		err := rows.Scan(&credit.ID, &credit.MovieID, &credit.PersonID, &credit.Role, &credit.Character, &credit.BillingOrder, name)
+		if err != nil {
+			return nil, err
+		}
+		credits = append(credits, &credit)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return credits, nil
+}
+
+type MockPersonModel struct{}
+
+func (m MockPersonModel) Insert(person *Person) error {
+	return nil
+}
+
+func (m MockPersonModel) Get(id int64) (*Person, error) {
+	return nil, nil
+}
+
+func (m MockPersonModel) GetAll(name string, pageSize int, cursor *Cursor) ([]*Person, Metadata, error) {
+	return nil, Metadata{}, nil
+}
+
+func (m MockPersonModel) Update(person *Person) error {
+	return nil
+}
+
+func (m MockPersonModel) Delete(id int64) error {
+	return nil
+}
+
+func (m MockPersonModel) AddCredit(credit *Credit) error {
+	return nil
+}
+
+func (m MockPersonModel) GetCredits(movieID int64) ([]*Credit, error) {
+	return nil, nil
+}
+
+func (m MockPersonModel) CreditsFor(ids []int64) (map[int64][]*Credit, error) {
+	return nil, nil
+}
+
+func (m MockPersonModel) DeleteCredit(movieID, id int64) error {
+	return nil
+}
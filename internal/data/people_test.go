@@ -0,0 +1,23 @@
+package data
+
+import "testing"
+
+func TestLikeEscaper(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Pete Docter", "Pete Docter"},
+		{"100%", `100\%`},
+		{"john_doe", `john\_doe`},
+		{`back\slash`, `back\\slash`},
+		{`\%_`, `\\\%\_`},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := likeEscaper.Replace(tt.name); got != tt.want {
+			t.Errorf("likeEscaper.Replace(%q) = %q; want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package data
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// orderedMovies describes a table that keeps movies in order within a parent
+// (a list or a collection), in a position column running from 1 without gaps.
+// Its (parent, position) unique constraint must be deferrable, so that one
+// UPDATE can shift a run of rows by one. The callers lock the parent row first
+// so that changes to one parent's order happen one at a time.
+//
+// Movies in the trash keep their stored position but aren't shown, so the
+// positions clients see and give count only the movies shown. makeRoom() and
+// move() map those onto stored positions
+type orderedMovies struct {
+	table       string
+	parent      string
+	parentTable string
+}
+
+var (
+	listItems        = orderedMovies{table: "list_items", parent: "list_id", parentTable: "lists"}
+	collectionMovies = orderedMovies{table: "collection_movies", parent: "collection_id", parentTable: "collections"}
+)
+
+// last() returns the highest position in use, or 0 if there are no movies
+func (o orderedMovies) last(tx *sql.Tx, parentID int64) (int, error) {
+	query := fmt.Sprintf(`SELECT COALESCE(MAX(position), 0) FROM %s WHERE %s = $1`, o.table, o.parent)
+
+	var last int
+	err := tx.QueryRow(query, parentID).Scan(&last)
+	return last, err
+}
+
+// shown() returns the stored positions of the movies not in the trash, in order
+func (o orderedMovies) shown(tx *sql.Tx, parentID int64) ([]int, error) {
+	query := fmt.Sprintf(`
+    SELECT t.position
+    FROM %s t
+    JOIN movies m ON m.id = t.movie_id
+    WHERE t.%s = $1 AND m.deleted_at IS NULL
+    ORDER BY t.position`, o.table, o.parent)
+
+	rows, err := tx.Query(query, parentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var positions []int
+	for rows.Next() {
+		var position int
+		if err := rows.Scan(&position); err != nil {
+			return nil, err
+		}
+		positions = append(positions, position)
+	}
+	return positions, rows.Err()
+}
+
+// storedPosition() maps a position counting only the movies shown onto the
+// stored position of the movie shown there, given the stored positions of the
+// movies shown. A position of 0 or past the end gives end instead
+func storedPosition(shown []int, position, end int) int {
+	if position < 1 || position > len(shown) {
+		return end
+	}
+	return shown[position-1]
+}
+
+// makeRoom() moves the movies from position on down by one, ready for a new
+// movie to be inserted there. A position of 0 or past the end means the end.
+// It returns the stored position to insert at and the position the new movie
+// will be shown at
+func (o orderedMovies) makeRoom(tx *sql.Tx, parentID int64, position int) (stored, at int, err error) {
+	last, err := o.last(tx, parentID)
+	if err != nil {
+		return 0, 0, err
+	}
+	shown, err := o.shown(tx, parentID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if position < 1 || position > len(shown) {
+		return last + 1, len(shown) + 1, nil
+	}
+	stored = storedPosition(shown, position, last+1)
+
+	query := fmt.Sprintf(`UPDATE %s SET position = position + 1 WHERE %s = $1 AND position >= $2`, o.table, o.parent)
+	_, err = tx.Exec(query, parentID, stored)
+	return stored, position, err
+}
+
+// move() moves a movie to a new position, shifting the movies in between by
+// one. A position past the end moves it to the end. A movie that isn't there
+// gives sql.ErrNoRows
+func (o orderedMovies) move(tx *sql.Tx, parentID, movieID int64, position int) error {
+	var current int
+	query := fmt.Sprintf(`SELECT position FROM %s WHERE %s = $1 AND movie_id = $2`, o.table, o.parent)
+	if err := tx.QueryRow(query, parentID, movieID).Scan(&current); err != nil {
+		return err
+	}
+
+	last, err := o.last(tx, parentID)
+	if err != nil {
+		return err
+	}
+	shown, err := o.shown(tx, parentID)
+	if err != nil {
+		return err
+	}
+	// taking the place of the movie shown there puts this one after it when
+	// moving down and before it when moving up, either way at that position
+	position = storedPosition(shown, position, last)
+	if position == current {
+		return nil
+	}
+
+	// everything between the old and new position moves one step towards the gap
+	query = fmt.Sprintf(`
+    UPDATE %[1]s
+    SET position = CASE
+        WHEN movie_id = $2 THEN $4
+        WHEN $3 < $4 THEN position - 1
+        ELSE position + 1
+    END
+    WHERE %[2]s = $1 AND position BETWEEN LEAST($3, $4) AND GREATEST($3, $4)`, o.table, o.parent)
+
+	_, err = tx.Exec(query, parentID, movieID, current, position)
+	return err
+}
+
+// remove() deletes a movie and closes the gap it leaves. A movie that isn't
+// there gives sql.ErrNoRows
+func (o orderedMovies) remove(tx *sql.Tx, parentID, movieID int64) error {
+	var position int
+	query := fmt.Sprintf(`DELETE FROM %s WHERE %s = $1 AND movie_id = $2 RETURNING position`, o.table, o.parent)
+	if err := tx.QueryRow(query, parentID, movieID).Scan(&position); err != nil {
+		return err
+	}
+
+	query = fmt.Sprintf(`UPDATE %s SET position = position - 1 WHERE %s = $1 AND position > $2`, o.table, o.parent)
+	_, err := tx.Exec(query, parentID, position)
+	return err
+}
+
+// repoint() gives every place a movie has to another movie, as when merging
+// the two. Where a parent already has the other movie the place is removed
+// instead. The parents involved are locked here, in id order
+func (o orderedMovies) repoint(tx *sql.Tx, fromID, toID int64) error {
+	query := fmt.Sprintf(`
+    SELECT id FROM %[1]s
+    WHERE id IN (SELECT %[2]s FROM %[3]s WHERE movie_id = $1)
+    ORDER BY id
+    FOR UPDATE`, o.parentTable, o.parent, o.table)
+	if _, err := tx.Exec(query, fromID); err != nil {
+		return err
+	}
+
+	query = fmt.Sprintf(`
+    SELECT %[1]s FROM %[2]s
+    WHERE movie_id = $1 AND %[1]s IN (SELECT %[1]s FROM %[2]s WHERE movie_id = $2)`, o.parent, o.table)
+	rows, err := tx.Query(query, fromID, toID)
+	if err != nil {
+		return err
+	}
+	var shared []int64
+	for rows.Next() {
+		var parentID int64
+		if err := rows.Scan(&parentID); err != nil {
+			rows.Close()
+			return err
+		}
+		shared = append(shared, parentID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, parentID := range shared {
+		if err := o.remove(tx, parentID, fromID); err != nil {
+			return err
+		}
+	}
+
+	query = fmt.Sprintf(`UPDATE %s SET movie_id = $2 WHERE movie_id = $1`, o.table)
+	_, err = tx.Exec(query, fromID, toID)
+	return err
+}
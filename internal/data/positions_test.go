@@ -0,0 +1,104 @@
+package data
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestStoredPosition(t *testing.T) {
+	// stored positions 2 and 4 hold movies in the trash
+	shown := []int{1, 3, 5}
+
+	tests := []struct {
+		position int
+		want     int
+	}{
+		{0, 99},
+		{1, 1},
+		{2, 3},
+		{3, 5},
+		{4, 99},
+	}
+
+	for _, tt := range tests {
+		if got := storedPosition(shown, tt.position, 99); got != tt.want {
+			t.Errorf("storedPosition(%v, %d) = %d; want %d", shown, tt.position, got, tt.want)
+		}
+	}
+}
+
+// TestShownPositions checks that adding or moving a movie puts it at the
+// position given when counting only the movies shown, by replaying what
+// makeRoom() and move() do to the stored order
+func TestShownPositions(t *testing.T) {
+	// movies in the trash are in capitals
+	stored := []string{"a", "B", "c", "D", "e"}
+
+	shownPositions := func(order []string) []int {
+		var positions []int
+		for i, movie := range order {
+			if movie == strings.ToLower(movie) {
+				positions = append(positions, i+1)
+			}
+		}
+		return positions
+	}
+	shownMovies := func(order []string) []string {
+		var movies []string
+		for _, movie := range order {
+			if movie == strings.ToLower(movie) {
+				movies = append(movies, movie)
+			}
+		}
+		return movies
+	}
+
+	add := []struct {
+		position int
+		want     []string
+	}{
+		{1, []string{"x", "a", "c", "e"}},
+		{2, []string{"a", "x", "c", "e"}},
+		{3, []string{"a", "c", "x", "e"}},
+		{4, []string{"a", "c", "e", "x"}},
+		{0, []string{"a", "c", "e", "x"}},
+		{9, []string{"a", "c", "e", "x"}},
+	}
+
+	for _, tt := range add {
+		shown := shownPositions(stored)
+		at := storedPosition(shown, tt.position, len(stored)+1)
+		order := slices.Insert(slices.Clone(stored), at-1, "x")
+		if got := shownMovies(order); !slices.Equal(got, tt.want) {
+			t.Errorf("adding at %d: got %q; want %q", tt.position, got, tt.want)
+		}
+	}
+
+	move := []struct {
+		movie    string
+		position int
+		want     []string
+	}{
+		{"a", 1, []string{"a", "c", "e"}},
+		{"a", 2, []string{"c", "a", "e"}},
+		{"a", 3, []string{"c", "e", "a"}},
+		{"a", 9, []string{"c", "e", "a"}},
+		{"e", 1, []string{"e", "a", "c"}},
+		{"e", 2, []string{"a", "e", "c"}},
+		{"c", 1, []string{"c", "a", "e"}},
+		{"c", 3, []string{"a", "e", "c"}},
+	}
+
+	for _, tt := range move {
+		shown := shownPositions(stored)
+		at := storedPosition(shown, tt.position, len(stored))
+		order := slices.Clone(stored)
+		current := slices.Index(order, tt.movie)
+		order = slices.Delete(order, current, current+1)
+		order = slices.Insert(order, at-1, tt.movie)
+		if got := shownMovies(order); !slices.Equal(got, tt.want) {
+			t.Errorf("moving %s to %d: got %q; want %q", tt.movie, tt.position, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+// ErrDuplicateRelation is returned when two movies are already related
+var ErrDuplicateRelation = errors.New("movies are already related")
+
+// RelationInverses maps each relation type to the type of the same relation
+// seen from the other movie: if X is a sequel of Y, Y is a prequel of X
+var RelationInverses = map[string]string{
+	"sequel":          "prequel",
+	"prequel":         "sequel",
+	"remake":          "original",
+	"original":        "remake",
+	"spin_off":        "spin_off_source",
+	"spin_off_source": "spin_off",
+}
+
+// storedRelationTypes are the types relations are saved as; the others are
+// stored as their inverse with the movies swapped
+var storedRelationTypes = []string{"sequel", "remake", "spin_off"}
+
+// MaxRelationDepth is how many steps GET /v1/movies/:id/related may walk
+const MaxRelationDepth = 5
+
+// Relation is a typed edge between two movies: MovieID is a Type of RelatedID
+type Relation struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	MovieID   int64     `json:"movie_id"`
+	RelatedID int64     `json:"related_id"`
+	Type      string    `json:"type"`
+}
+
+// RelatedMovie is a movie reached by walking the relations graph. It is a
+// Relation of the movie Via, which is Depth-1 steps from the starting movie
+type RelatedMovie struct {
+	ID         int64  `json:"id"`
+	Title      string `json:"title"`
+	Year       int32  `json:"year,omitempty"`
+	Relation   string `json:"relation"`
+	Via        int64  `json:"via"`
+	Depth      int    `json:"depth"`
+	RelationID int64  `json:"relation_id"`
+}
+
+func ValidateRelation(v *validator.Validator, relation *Relation) {
+	v.Check(relation.RelatedID > 0, "related_id", "must be a positive integer")
+	v.Check(relation.RelatedID != relation.MovieID, "related_id", "must be a different movie")
+	_, ok := RelationInverses[relation.Type]
+	v.Check(ok, "type", "must be one of sequel, prequel, remake, original, spin_off or spin_off_source")
+}
+
+// Define a RelationModel struct which wraps a sql.DB connection pool
+type RelationModel struct {
+	DB *sql.DB
+}
+
+// Insert saves a relation. The relation keeps the direction it was given in,
+// whichever way round it is stored
+func (m *RelationModel) Insert(relation *Relation) error {
+	movieID, relatedID, relationType := relation.MovieID, relation.RelatedID, relation.Type
+	if !validator.In(relationType, storedRelationTypes...) {
+		movieID, relatedID, relationType = relatedID, movieID, RelationInverses[relationType]
+	}
+
+	err := withTx(m.DB, nil, func(tx *sql.Tx) error {
+		var movieExists, relatedExists bool
+		err := tx.QueryRow(`
+        SELECT EXISTS (SELECT 1 FROM movies WHERE id = $1 AND deleted_at IS NULL),
+            EXISTS (SELECT 1 FROM movies WHERE id = $2 AND deleted_at IS NULL)`,
+			relation.MovieID, relation.RelatedID).Scan(&movieExists, &relatedExists)
+		switch {
+		case err != nil:
+			return err
+		case !movieExists:
+			return ErrorRecordNotFound
+		case !relatedExists:
+			return ErrMovieNotFound
+		}
+
+		query := `
+        INSERT INTO movie_relations (movie_id, related_id, type)
+        VALUES ($1, $2, $3)
+        RETURNING id, created_at`
+
+		return tx.QueryRow(query, movieID, relatedID, relationType).Scan(&relation.ID, &relation.CreatedAt)
+	})
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case errors.As(err, &pqErr) && pqErr.Code == "23505":
+			return ErrDuplicateRelation
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a relation from either of its movies
+func (m *RelationModel) Delete(movieID, id int64) error {
+	if id < 1 {
+		return ErrorRecordNotFound
+	}
+
+	result, err := m.DB.Exec(`DELETE FROM movie_relations WHERE id = $1 AND $2 IN (movie_id, related_id)`, id, movieID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrorRecordNotFound
+	}
+	return nil
+}
+
+// Related walks the relations graph out from a movie, in both directions, up to
+// depth steps. Each movie is reported once, by the shortest way to it, and the
+// walk never goes back through a movie already on its path. Movies in the
+// trash are neither reported nor walked through
+func (m *RelationModel) Related(movieID int64, depth int) ([]*RelatedMovie, error) {
+	query := `
+    WITH RECURSIVE edges AS (
+        SELECT id, movie_id AS from_id, related_id AS to_id, type, false AS reversed
+        FROM movie_relations
+        UNION ALL
+        SELECT id, related_id, movie_id, type, true
+        FROM movie_relations
+    ), walk AS (
+        SELECT e.to_id AS movie_id, e.from_id AS via, e.id, e.type, e.reversed,
+            1 AS depth, ARRAY[e.from_id, e.to_id] AS path
+        FROM edges e
+        JOIN movies m ON m.id = e.to_id AND m.deleted_at IS NULL
+        WHERE e.from_id = $1
+        UNION ALL
+        SELECT e.to_id, e.from_id, e.id, e.type, e.reversed, w.depth + 1, w.path || e.to_id
+        FROM walk w
+        JOIN edges e ON e.from_id = w.movie_id
+        JOIN movies m ON m.id = e.to_id AND m.deleted_at IS NULL
+        WHERE w.depth < $2 AND NOT e.to_id = ANY(w.path)
+    )
+    SELECT DISTINCT ON (w.movie_id) w.movie_id, m.title, m.year, w.type, w.reversed, w.via, w.depth, w.id
+    FROM walk w
+    JOIN movies m ON m.id = w.movie_id
+    ORDER BY w.movie_id, w.depth, w.via`
+
+	rows, err := m.DB.Query(query, movieID, depth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	related := []*RelatedMovie{}
+	for rows.Next() {
+		var movie RelatedMovie
+		var reversed bool
+		err := rows.Scan(&movie.ID, &movie.Title, &movie.Year, &movie.Relation, &reversed, &movie.Via, &movie.Depth, &movie.RelationID)
+		if err != nil {
+			return nil, err
+		}
+		// the stored edge reads "movie_id is a <type> of related_id"; walking it
+		// forwards reaches the related movie, which is the inverse of that
+		if !reversed {
+			movie.Relation = RelationInverses[movie.Relation]
+		}
+		related = append(related, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(related, func(i, j int) bool {
+		return related[i].Depth < related[j].Depth
+	})
+	return related, nil
+}
+
+type MockRelationModel struct{}
+
+func (m MockRelationModel) Insert(relation *Relation) error {
+	return nil
+}
+
+func (m MockRelationModel) Delete(movieID, id int64) error {
+	return nil
+}
+
+func (m MockRelationModel) Related(movieID int64, depth int) ([]*RelatedMovie, error) {
+	return nil, nil
+}
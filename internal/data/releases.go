@@ -0,0 +1,294 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+// ErrDuplicateRelease is returned when a movie already has a release of the
+// same type in the same country
+var ErrDuplicateRelease = errors.New("movie already has a release of this type in this country")
+
+// ReleaseTypes are the kinds of release a movie can have, from the first
+// screening at a festival or premiere to showings on television
+var ReleaseTypes = []string{"premiere", "limited", "theatrical", "digital", "physical", "tv"}
+
+// releaseYearsAhead is how many years past the current one a release can be
+// scheduled for, and so how far ahead a movie's year can be
+const releaseYearsAhead = 5
+
+// releaseYearSQL is the year of a movie's earliest release, or NULL if it has
+// none. The %s is replaced by the SQL for the movie's id
+const releaseYearSQL = `(SELECT extract(year FROM min(date))::integer FROM movie_releases WHERE movie_id = %s)`
+
+// Release is when and how a movie came out in one country, with the age
+// rating it was given there
+type Release struct {
+	ID            int64  `json:"id"`
+	MovieID       int64  `json:"movie_id"`
+	Country       string `json:"country"`
+	Date          Date   `json:"date"`
+	Type          string `json:"type"`
+	Certification string `json:"certification,omitempty"`
+	Version       int32  `json:"version"`
+}
+
+// ValidateRelease checks a release, putting its country code in upper case.
+// The certification must be one the country's rating system gives out
+func ValidateRelease(v *validator.Validator, release *Release) {
+	release.Country = strings.ToUpper(release.Country)
+	v.Check(release.Country != "", "country", "must be provided")
+	v.Check(validator.Matches(release.Country, validator.CountryCodeRX), "country", "must be a two letter ISO 3166 country code")
+
+	v.Check(!release.Date.IsZero(), "date", "must be provided")
+	v.Check(release.Date.Year() >= 1888, "date", "must not be before 1888")
+	v.Check(release.Date.Year() <= time.Now().Year()+releaseYearsAhead, "date", fmt.Sprintf("must not be more than %d years ahead", releaseYearsAhead))
+
+	v.Check(release.Type != "", "type", "must be provided")
+	v.Check(validator.In(release.Type, ReleaseTypes...), "type", "must be one of "+strings.Join(ReleaseTypes, ", "))
+
+	v.Check(len(release.Certification) <= 20, "certification", "must not be more than 20 bytes long")
+	if ratings, ok := validator.RatingSystems[release.Country]; ok && release.Certification != "" {
+		v.Check(validator.Certified(release.Country, release.Certification), "certification",
+			fmt.Sprintf("must be one of %s for %s", strings.Join(ratings, ", "), release.Country))
+	}
+}
+
+// ReleaseFilter keeps the movies released in Country (any country if empty)
+// between From and To inclusive. A nil bound is open, and the zero value
+// keeps every movie, released or not
+type ReleaseFilter struct {
+	Country string
+	From    *Date
+	To      *Date
+}
+
+// ValidateReleaseFilter checks the country and that the window isn't backwards
+func ValidateReleaseFilter(v *validator.Validator, f ReleaseFilter) {
+	if f.Country != "" {
+		v.Check(validator.Matches(f.Country, validator.CountryCodeRX), "country", "must be a two letter ISO 3166 country code")
+	}
+	if f.From != nil && f.To != nil {
+		v.Check(!f.To.Before(f.From.Time), "released_to", "must not be before released_from")
+	}
+}
+
+// args() returns the query arguments for releaseCondition()
+func (f ReleaseFilter) args() []interface{} {
+	return []interface{}{f.Country, f.From, f.To}
+}
+
+// releaseCondition() returns the SQL condition for a ReleaseFilter whose
+// country, from and to are the query arguments starting at placeholder n
+func releaseCondition(n int) string {
+	return fmt.Sprintf(`AND (($%[1]d::text = '' AND $%[2]d::date IS NULL AND $%[3]d::date IS NULL) OR id IN (
+            SELECT movie_id FROM movie_releases
+            WHERE ($%[1]d::text = '' OR country = $%[1]d::text)
+            AND ($%[2]d::date IS NULL OR date >= $%[2]d::date)
+            AND ($%[3]d::date IS NULL OR date <= $%[3]d::date)
+        ))`, n, n+1, n+2)
+}
+
+// Define a ReleaseModel struct which wraps a sql.DB connection pool. Changing
+// the releases of a movie can change its year, which is a new version of the
+// movie made by actor
+type ReleaseModel struct {
+	DB    *sql.DB
+	tx    *sql.Tx // set when the model belongs to Models.Transaction()
+	actor string
+}
+
+// conn() returns the transaction if the model belongs to one, otherwise the pool
+func (m *ReleaseModel) conn() querier {
+	if m.tx != nil {
+		return m.tx
+	}
+	return m.DB
+}
+
+// GetAll returns the releases of a movie, earliest first
+func (m *ReleaseModel) GetAll(movieID int64) ([]*Release, error) {
+	query := `
+    SELECT id, movie_id, country, date, type, certification, version
+    FROM movie_releases
+    WHERE movie_id = $1
+    ORDER BY date, country, type`
+
+	rows, err := m.conn().Query(query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	releases := []*Release{}
+	for rows.Next() {
+		release, err := scanRelease(rows)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, release)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return releases, nil
+}
+
+// ReleasesFor returns the releases of several movies at once, keyed by movie
+// id. Movies without releases are left out
+func (m *ReleaseModel) ReleasesFor(ids []int64) (map[int64][]*Release, error) {
+	query := `
+    SELECT id, movie_id, country, date, type, certification, version
+    FROM movie_releases
+    WHERE movie_id = ANY($1)
+    ORDER BY movie_id, date, country, type`
+
+	rows, err := m.conn().Query(query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	releases := make(map[int64][]*Release)
+	for rows.Next() {
+		release, err := scanRelease(rows)
+		if err != nil {
+			return nil, err
+		}
+		releases[release.MovieID] = append(releases[release.MovieID], release)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return releases, nil
+}
+
+// Insert adds a release to a movie. A movie that doesn't exist or is in the
+// trash gives ErrorRecordNotFound
+func (m *ReleaseModel) Insert(release *Release) error {
+	query := `
+    INSERT INTO movie_releases (movie_id, country, date, type, certification)
+    VALUES ($1, $2, $3, $4, $5)
+    RETURNING id, version`
+
+	return m.write(release.MovieID, func(tx *sql.Tx) error {
+		return tx.QueryRow(query, release.MovieID, release.Country, release.Date, release.Type, release.Certification).Scan(
+			&release.ID, &release.Version)
+	})
+}
+
+// Update replaces a release of a movie, counting it as a new version
+func (m *ReleaseModel) Update(release *Release) error {
+	query := `
+    UPDATE movie_releases
+    SET country = $1, date = $2, type = $3, certification = $4, version = version + 1
+    WHERE id = $5 AND movie_id = $6
+    RETURNING version`
+
+	return m.write(release.MovieID, func(tx *sql.Tx) error {
+		return tx.QueryRow(query, release.Country, release.Date, release.Type, release.Certification, release.ID, release.MovieID).Scan(
+			&release.Version)
+	})
+}
+
+func (m *ReleaseModel) Delete(movieID, id int64) error {
+	return m.write(movieID, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`DELETE FROM movie_releases WHERE id = $1 AND movie_id = $2`, id, movieID)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return ErrorRecordNotFound
+		}
+		return nil
+	})
+}
+
+// write() runs fn in a transaction with the movie locked, then sets the
+// movie's year to that of its earliest release if that changed it. A movie
+// without releases keeps the year it has
+func (m *ReleaseModel) write(movieID int64, fn func(tx *sql.Tx) error) error {
+	err := withTx(m.DB, m.tx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`SELECT set_config('greenlight.actor', $1, true)`, m.actor)
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRow(`SELECT id FROM movies WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, movieID).Scan(&movieID)
+		if err != nil {
+			return err
+		}
+		if err := fn(tx); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(fmt.Sprintf(`
+        UPDATE movies
+        SET year = earliest.year, version = version + 1
+        FROM (SELECT %s AS year) earliest
+        WHERE movies.id = $1 AND earliest.year IS NOT NULL AND movies.year <> earliest.year`, fmt.Sprintf(releaseYearSQL, "$1")), movieID)
+		return err
+	})
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrorRecordNotFound
+		case errors.As(err, &pqErr) && pqErr.Code == "23505":
+			return ErrDuplicateRelease
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// scanRelease() reads a release from a row of the columns GetAll() selects
+func scanRelease(row rowScanner) (*Release, error) {
+	var release Release
+	err := row.Scan(
+		&release.ID,
+		&release.MovieID,
+		&release.Country,
+		&release.Date,
+		&release.Type,
+		&release.Certification,
+		&release.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &release, nil
+}
+
+type MockReleaseModel struct{}
+
+func (m MockReleaseModel) GetAll(movieID int64) ([]*Release, error) {
+	return nil, nil
+}
+
+func (m MockReleaseModel) ReleasesFor(ids []int64) (map[int64][]*Release, error) {
+	return nil, nil
+}
+
+func (m MockReleaseModel) Insert(release *Release) error {
+	return nil
+}
+
+func (m MockReleaseModel) Update(release *Release) error {
+	return nil
+}
+
+func (m MockReleaseModel) Delete(movieID, id int64) error {
+	return nil
+}
@@ -0,0 +1,72 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+func TestValidateRelease(t *testing.T) {
+	date := NewDate(time.Date(2010, 7, 16, 0, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		name        string
+		release     Release
+		wantCountry string
+		wantErrors  []string
+	}{
+		{"valid", Release{Country: "US", Date: date, Type: "theatrical", Certification: "PG-13"}, "US", nil},
+		{"country upper cased", Release{Country: "gb", Date: date, Type: "theatrical", Certification: "12A"}, "GB", nil},
+		{"no certification", Release{Country: "US", Date: date, Type: "digital"}, "US", nil},
+		{"country without a rating system", Release{Country: "SE", Date: date, Type: "theatrical", Certification: "15"}, "SE", nil},
+		{"missing country", Release{Date: date, Type: "theatrical"}, "", []string{"country"}},
+		{"bad country", Release{Country: "USA", Date: date, Type: "theatrical"}, "USA", []string{"country"}},
+		{"missing date", Release{Country: "US", Type: "theatrical"}, "US", []string{"date"}},
+		{"too early", Release{Country: "US", Date: NewDate(time.Date(1887, 12, 31, 0, 0, 0, 0, time.UTC)), Type: "theatrical"}, "US", []string{"date"}},
+		{"scheduled", Release{Country: "US", Date: NewDate(time.Now().AddDate(1, 0, 0)), Type: "theatrical"}, "US", nil},
+		{"scheduled at the horizon", Release{Country: "US", Date: NewDate(time.Date(time.Now().Year()+releaseYearsAhead, 12, 31, 0, 0, 0, 0, time.UTC)), Type: "theatrical"}, "US", nil},
+		{"past the horizon", Release{Country: "US", Date: NewDate(time.Date(time.Now().Year()+releaseYearsAhead+1, 1, 1, 0, 0, 0, 0, time.UTC)), Type: "theatrical"}, "US", []string{"date"}},
+		{"missing type", Release{Country: "US", Date: date}, "US", []string{"type"}},
+		{"unknown type", Release{Country: "US", Date: date, Type: "streaming"}, "US", []string{"type"}},
+		{"wrong country's certification", Release{Country: "US", Date: date, Type: "theatrical", Certification: "12A"}, "US", []string{"certification"}},
+		{"certification too long", Release{Country: "SE", Date: date, Type: "theatrical", Certification: "Barnförbjuden 15 år och äldre"}, "SE", []string{"certification"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateRelease(v, &tt.release)
+			assertValidationErrors(t, v, tt.wantErrors)
+			if tt.release.Country != tt.wantCountry {
+				t.Errorf("country = %q; want %q", tt.release.Country, tt.wantCountry)
+			}
+		})
+	}
+}
+
+func TestValidateReleaseFilter(t *testing.T) {
+	early := NewDate(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	late := NewDate(time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		name       string
+		filter     ReleaseFilter
+		wantErrors []string
+	}{
+		{"empty", ReleaseFilter{}, nil},
+		{"country and window", ReleaseFilter{Country: "FR", From: &early, To: &late}, nil},
+		{"one day", ReleaseFilter{From: &early, To: &early}, nil},
+		{"open ended", ReleaseFilter{To: &early}, nil},
+		{"bad country", ReleaseFilter{Country: "fr"}, []string{"country"}},
+		{"backwards", ReleaseFilter{From: &late, To: &early}, []string{"released_to"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateReleaseFilter(v, tt.filter)
+			assertValidationErrors(t, v, tt.wantErrors)
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+type Review struct {
+	ID        int64     `json:"id"`
+	MovieID   int64     `json:"movie_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Author    string    `json:"author"`
+	Score     int32     `json:"score"`
+	Text      string    `json:"text,omitempty"` // a review can be just a score
+	Version   int32     `json:"version"`
+}
+
+// ValidateReview checks the fields a client can set on a review
+func ValidateReview(v *validator.Validator, review *Review) {
+	v.Check(review.Author != "", "author", "must be provided")
+	v.Check(len(review.Author) <= 100, "author", "must not be more than 100 bytes long")
+
+	v.Check(review.Score >= 1, "score", "must be between 1 and 10")
+	v.Check(review.Score <= 10, "score", "must be between 1 and 10")
+
+	v.Check(len(review.Text) <= 10000, "text", "must not be more than 10000 bytes long")
+}
+
+// Define a ReviewModel struct which wraps a sql.DB connection pool. Every write
+// also adjusts the rating totals on the movie in the same transaction, so the
+// average is always in step with the reviews
+type ReviewModel struct {
+	DB *sql.DB
+	tx *sql.Tx // set when the model belongs to Models.Transaction()
+}
+
+func (m *ReviewModel) conn() querier {
+	if m.tx != nil {
+		return m.tx
+	}
+	return m.DB
+}
+
+// Insert adds a review to a movie. Movies in the trash can't be reviewed
+func (m *ReviewModel) Insert(review *Review) error {
+	query := `
+    INSERT INTO reviews (movie_id, author, score, text)
+    SELECT id, $2, $3, $4
+    FROM movies
+    WHERE id = $1 AND deleted_at IS NULL
+    RETURNING id, created_at, updated_at, version`
+
+	args := []interface{}{review.MovieID, review.Author, review.Score, review.Text}
+
+	err := withTx(m.DB, m.tx, func(tx *sql.Tx) error {
+		err := tx.QueryRow(query, args...).Scan(&review.ID, &review.CreatedAt, &review.UpdatedAt, &review.Version)
+		if err != nil {
+			return err
+		}
+		return adjustRating(tx, review.MovieID, 1, review.Score)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrorRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns a review of a movie
+func (m *ReviewModel) Get(movieID, id int64) (*Review, error) {
+	if movieID < 1 || id < 1 {
+		return nil, ErrorRecordNotFound
+	}
+
+	query := `
+    SELECT r.id, r.movie_id, r.created_at, r.updated_at, r.author, r.score, r.text, r.version
+    FROM reviews r
+    JOIN movies m ON m.id = r.movie_id
+    WHERE r.id = $1 AND r.movie_id = $2 AND m.deleted_at IS NULL`
+
+	var review Review
+	err := m.conn().QueryRow(query, id, movieID).Scan(
+		&review.ID,
+		&review.MovieID,
+		&review.CreatedAt,
+		&review.UpdatedAt,
+		&review.Author,
+		&review.Score,
+		&review.Text,
+		&review.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &review, nil
+}
+
+// ReviewSort is the Sort of the cursors GetAll() pages reviews with
+const ReviewSort = "-created_at"
+
+// GetAll returns a page of the reviews of a movie, newest first, starting
+// after the cursor (or from the start if it is nil)
+func (m *ReviewModel) GetAll(movieID int64, pageSize int, cursor *Cursor) ([]*Review, Metadata, error) {
+	backward := cursor != nil && cursor.Backward
+
+	// one more than a page is read to tell whether there is another page
+	comparison, direction := "<", "DESC"
+	if backward {
+		comparison, direction = ">", "ASC"
+	}
+	query := fmt.Sprintf(`
+    SELECT id, movie_id, created_at, updated_at, author, score, text, version
+    FROM reviews
+    WHERE movie_id = $1 AND ($3::bigint IS NULL OR (created_at, id) %s ($4::timestamptz, $3))
+    ORDER BY created_at %[2]s, id %[2]s
+    LIMIT $2`, comparison, direction)
+
+	var cursorID *int64
+	var cursorCreatedAt *string
+	if cursor != nil {
+		cursorID, cursorCreatedAt = &cursor.ID, &cursor.Value
+	}
+
+	rows, err := m.conn().Query(query, movieID, pageSize+1, cursorID, cursorCreatedAt)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	reviews := []*Review{}
+	for rows.Next() {
+		var review Review
+		err := rows.Scan(
+			&review.ID,
+			&review.MovieID,
+			&review.CreatedAt,
+			&review.UpdatedAt,
+			&review.Author,
+			&review.Score,
+			&review.Text,
+			&review.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		reviews = append(reviews, &review)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	hasMore := len(reviews) > pageSize
+	if hasMore {
+		reviews = reviews[:pageSize]
+	}
+	if backward {
+		slices.Reverse(reviews)
+	}
+
+	var first, last *Cursor
+	if len(reviews) > 0 {
+		first, last = reviewCursor(reviews[0]), reviewCursor(reviews[len(reviews)-1])
+	}
+	return reviews, pageMetadata(pageSize, cursor, hasMore, first, last), nil
+}
+
+// reviewCursor() returns the cursor for a review
+func reviewCursor(review *Review) *Cursor {
+	return &Cursor{Sort: ReviewSort, Value: review.CreatedAt.Format(time.RFC3339Nano), ID: review.ID}
+}
+
+// Update saves a changed review if it is still at review.Version, and gives
+// ErrEditConflict if someone else updated it first. The review row is locked
+// while the old score is read, so concurrent updates can't get the rating
+// totals wrong
+func (m *ReviewModel) Update(review *Review) error {
+	query := `
+    WITH old AS (
+        SELECT r.id, r.score
+        FROM reviews r
+        JOIN movies m ON m.id = r.movie_id
+        WHERE r.id = $4 AND r.movie_id = $5 AND r.version = $6 AND m.deleted_at IS NULL
+        FOR UPDATE OF r
+    )
+    UPDATE reviews
+    SET author = $1, score = $2, text = $3, updated_at = NOW(), version = reviews.version + 1
+    FROM old
+    WHERE reviews.id = old.id
+    RETURNING old.score, reviews.updated_at, reviews.version`
+
+	args := []interface{}{review.Author, review.Score, review.Text, review.ID, review.MovieID, review.Version}
+
+	err := withTx(m.DB, m.tx, func(tx *sql.Tx) error {
+		var oldScore int32
+		err := tx.QueryRow(query, args...).Scan(&oldScore, &review.UpdatedAt, &review.Version)
+		if errors.Is(err, sql.ErrNoRows) {
+			// tell a review that has moved on to another version from a missing one
+			var exists bool
+			err = tx.QueryRow(`
+            SELECT EXISTS (
+                SELECT 1 FROM reviews r JOIN movies m ON m.id = r.movie_id
+                WHERE r.id = $1 AND r.movie_id = $2 AND m.deleted_at IS NULL
+            )`, review.ID, review.MovieID).Scan(&exists)
+			switch {
+			case err != nil:
+				return err
+			case exists:
+				return ErrEditConflict
+			default:
+				return sql.ErrNoRows
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return adjustRating(tx, review.MovieID, 0, review.Score-oldScore)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrorRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a review and takes its score out of the movie's rating
+func (m *ReviewModel) Delete(movieID, id int64) error {
+	if movieID < 1 || id < 1 {
+		return ErrorRecordNotFound
+	}
+
+	query := `
+    DELETE FROM reviews r
+    USING movies m
+    WHERE r.id = $1 AND r.movie_id = $2 AND m.id = r.movie_id AND m.deleted_at IS NULL
+    RETURNING r.score`
+
+	err := withTx(m.DB, m.tx, func(tx *sql.Tx) error {
+		var score int32
+		if err := tx.QueryRow(query, id, movieID).Scan(&score); err != nil {
+			return err
+		}
+		return adjustRating(tx, movieID, -1, -score)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrorRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// adjustRating() changes the rating totals of a movie by the given amounts. It
+// doesn't bump the version: ratings aren't part of the movie's revision history
+func adjustRating(tx *sql.Tx, movieID int64, count, score int32) error {
+	query := `
+    UPDATE movies
+    SET rating_count = rating_count + $2, rating_sum = rating_sum + $3
+    WHERE id = $1`
+
+	_, err := tx.Exec(query, movieID, count, score)
+	return err
+}
+
+type MockReviewModel struct{}
+
+func (m MockReviewModel) Insert(review *Review) error {
+	return nil
+}
+
+func (m MockReviewModel) Get(movieID, id int64) (*Review, error) {
+	return nil, nil
+}
+
+func (m MockReviewModel) GetAll(movieID int64, pageSize int, cursor *Cursor) ([]*Review, Metadata, error) {
+	return nil, Metadata{}, nil
+}
+
+func (m MockReviewModel) Update(review *Review) error {
+	return nil
+}
+
+func (m MockReviewModel) Delete(movieID, id int64) error {
+	return nil
+}
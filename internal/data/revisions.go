@@ -0,0 +1,218 @@
+package data
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"time"
+)
+
+// Revision is one version of a movie as it was saved, with who saved it and why.
+// Action is one of create, update, delete, restore, revert, merge, purge (the
+// movie as it was when removed for good) or baseline (the version a movie was
+// at when history recording started)
+type Revision struct {
+	MovieID   int64     `json:"movie_id"`
+	Version   int32     `json:"version"`
+	Action    string    `json:"action"`
+	Actor     string    `json:"actor,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Movie     *Movie    `json:"movie"`
+}
+
+// FieldChange is the old and new value of a field that differs between two revisions
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// DiffMovies returns the fields that changed from one version of a movie to
+// the next. With no previous version every field counts as changed
+func DiffMovies(from, to *Movie) map[string]FieldChange {
+	if from == nil {
+		from = &Movie{}
+	}
+
+	changes := map[string]FieldChange{}
+	if from.Title != to.Title {
+		changes["title"] = FieldChange{From: from.Title, To: to.Title}
+	}
+	if from.Year != to.Year {
+		changes["year"] = FieldChange{From: from.Year, To: to.Year}
+	}
+	if from.Runtime != to.Runtime {
+		changes["runtime"] = FieldChange{From: from.Runtime, To: to.Runtime}
+	}
+	if !slices.Equal(from.Genres, to.Genres) {
+		changes["genres"] = FieldChange{From: from.Genres, To: to.Genres}
+	}
+	if !maps.Equal(from.ExternalIDs, to.ExternalIDs) {
+		changes["external_ids"] = FieldChange{From: from.ExternalIDs, To: to.ExternalIDs}
+	}
+	if (from.DeletedAt == nil) != (to.DeletedAt == nil) {
+		changes["deleted_at"] = FieldChange{From: from.DeletedAt, To: to.DeletedAt}
+	}
+	return changes
+}
+
+// Define a RevisionModel struct which wraps a sql.DB connection pool
+type RevisionModel struct {
+	DB *sql.DB
+	tx *sql.Tx // set when the model belongs to Models.Transaction()
+}
+
+func (m *RevisionModel) conn() querier {
+	if m.tx != nil {
+		return m.tx
+	}
+	return m.DB
+}
+
+// historyVisibleSQL is the condition for the history of the movie with id $1
+// to be shown. Revisions are kept after a movie is purged, but are only shown
+// while the movie itself is there, in the trash or not, or if it was merged
+// into another movie, so the past of a merged duplicate can still be read
+const historyVisibleSQL = `(EXISTS (SELECT 1 FROM movies WHERE id = $1) OR EXISTS (SELECT 1 FROM movie_redirects WHERE movie_id = $1))`
+
+// GetAll returns every revision of a movie, newest first
+func (m *RevisionModel) GetAll(movieID int64) ([]*Revision, error) {
+	if movieID < 1 {
+		return nil, ErrorRecordNotFound
+	}
+
+	query := `
+    SELECT movie_id, version, action, COALESCE(actor, ''), created_at, snapshot
+    FROM movie_revisions
+    WHERE movie_id = $1 AND ` + historyVisibleSQL + `
+    ORDER BY version DESC`
+
+	rows, err := m.conn().Query(query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*Revision{}
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// a movie always has at least the revision it was created with
+	if len(revisions) == 0 {
+		return nil, ErrorRecordNotFound
+	}
+	return revisions, nil
+}
+
+// Get returns a single revision of a movie
+func (m *RevisionModel) Get(movieID int64, version int32) (*Revision, error) {
+	if movieID < 1 || version < 1 {
+		return nil, ErrorRecordNotFound
+	}
+
+	query := `
+    SELECT movie_id, version, action, COALESCE(actor, ''), created_at, snapshot
+    FROM movie_revisions
+    WHERE movie_id = $1 AND version = $2 AND ` + historyVisibleSQL
+
+	revision, err := scanRevision(m.conn().QueryRow(query, movieID, version))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return revision, nil
+}
+
+// Previous returns the revision before the given version, or nil if it is the
+// first one. Versions recorded before history began may be missing, so this is
+// the latest earlier revision rather than version - 1
+func (m *RevisionModel) Previous(movieID int64, version int32) (*Revision, error) {
+	query := `
+    SELECT movie_id, version, action, COALESCE(actor, ''), created_at, snapshot
+    FROM movie_revisions
+    WHERE movie_id = $1 AND version < $2
+    ORDER BY version DESC
+    LIMIT 1`
+
+	revision, err := scanRevision(m.conn().QueryRow(query, movieID, version))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+	return revision, nil
+}
+
+// rowScanner is a *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanRevision() reads a revision row, decoding the snapshot of the movie
+func scanRevision(row rowScanner) (*Revision, error) {
+	var revision Revision
+	var snapshot []byte
+	err := row.Scan(&revision.MovieID, &revision.Version, &revision.Action, &revision.Actor, &revision.CreatedAt, &snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	// the snapshot is the movies row as JSON, where runtime is a plain number
+	var stored struct {
+		ID        int64       `json:"id"`
+		CreatedAt time.Time   `json:"created_at"`
+		Title     string      `json:"title"`
+		Year      int32       `json:"year"`
+		Runtime   int32       `json:"runtime"`
+		Genres    []string    `json:"genres"`
+		External  ExternalIDs `json:"external_ids"`
+		Version   int32       `json:"version"`
+		DeletedAt *time.Time  `json:"deleted_at"`
+	}
+	if err := json.Unmarshal(snapshot, &stored); err != nil {
+		return nil, err
+	}
+
+	revision.Movie = &Movie{
+		ID:          stored.ID,
+		CreatedAt:   stored.CreatedAt,
+		Title:       stored.Title,
+		Year:        stored.Year,
+		Runtime:     Runtime(stored.Runtime),
+		Genres:      stored.Genres,
+		ExternalIDs: stored.External,
+		Version:     stored.Version,
+		DeletedAt:   stored.DeletedAt,
+	}
+	return &revision, nil
+}
+
+type MockRevisionModel struct{}
+
+func (m MockRevisionModel) GetAll(movieID int64) ([]*Revision, error) {
+	return nil, nil
+}
+
+func (m MockRevisionModel) Get(movieID int64, version int32) (*Revision, error) {
+	return nil, nil
+}
+
+func (m MockRevisionModel) Previous(movieID int64, version int32) (*Revision, error) {
+	return nil, nil
+}
@@ -17,9 +17,12 @@ var ErrInvalidRuntimeFormat = errors.New("invalid runtime format")
 // MarshalJSON method makes Runtime implement json.Marshaler interface
 func (r Runtime) MarshalJSON() ([]byte, error) {
 	// create string like 170 mins
-	jsonValue := fmt.Sprintf("%d mins", r)
+	jsonValue, err := r.MarshalText()
+	if err != nil {
+		return nil, err
+	}
 	// wraps the string in double quotes
-	quotedJSONValue := strconv.Quote(jsonValue)
+	quotedJSONValue := strconv.Quote(string(jsonValue))
 	// return as []byte
 	return []byte(quotedJSONValue), nil
 }
@@ -31,8 +34,18 @@ func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
 		return ErrInvalidRuntimeFormat
 	}
 
+	return r.UnmarshalText([]byte(unquotedJSONValue))
+}
+
+// MarshalText gives the "<number> mins" form used by every non-JSON format (XML, CSV)
+func (r Runtime) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d mins", r)), nil
+}
+
+// UnmarshalText parses the "<number> mins" form
+func (r *Runtime) UnmarshalText(text []byte) error {
 	// Split into parts: number and unit
-	parts := strings.Split(unquotedJSONValue, " ")
+	parts := strings.Split(string(text), " ")
 
 	// Check that format is exactly "<number> mins"
 	if len(parts) != 2 || parts[1] != "mins" {
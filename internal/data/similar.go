@@ -0,0 +1,154 @@
+package data
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// MaxSimilarMovies is how many similar movies are kept for each movie
+const MaxSimilarMovies = 50
+
+// SimilarMovie is a movie recommended alongside another one, with its overall
+// score, the parts that score is made of, and the reasons in words
+type SimilarMovie struct {
+	ID            int64            `json:"id"`
+	Title         string           `json:"title"`
+	Year          int32            `json:"year,omitempty"`
+	Runtime       Runtime          `json:"runtime,omitempty"`
+	AverageRating *float64         `json:"average_rating"`
+	Score         float64          `json:"score"`
+	Scores        SimilarityScores `json:"scores"`
+	Reasons       []string         `json:"reasons"`
+}
+
+// SimilarityScores are the parts of a similarity score, each from 0 to 1.
+// Rating is nil unless both movies have been rated
+type SimilarityScores struct {
+	Genres  float64  `json:"genres"`
+	Year    float64  `json:"year"`
+	Runtime float64  `json:"runtime"`
+	Rating  *float64 `json:"rating"`
+}
+
+// Define a SimilarityModel struct which wraps a sql.DB connection pool. The
+// scores come from the movie_similarities materialized view, so they are as
+// old as its last refresh
+type SimilarityModel struct {
+	DB *sql.DB
+}
+
+// Similar returns up to limit movies most like the given one, best first.
+// Movies in the trash since the last refresh are left out
+func (m *SimilarityModel) Similar(movieID int64, limit int) ([]*SimilarMovie, error) {
+	query := `
+    SELECT m.id, m.title, m.year, m.runtime, m.average_rating,
+        s.score, s.genre_score, s.year_score, s.runtime_score, s.rating_score, s.shared_genres,
+        o.year, o.runtime, o.average_rating
+    FROM movie_similarities s
+    JOIN movies m ON m.id = s.similar_id AND m.deleted_at IS NULL
+    JOIN movies o ON o.id = s.movie_id
+    WHERE s.movie_id = $1
+    ORDER BY s.score DESC, s.similar_id
+    LIMIT $2`
+
+	rows, err := m.DB.Query(query, movieID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	similar := []*SimilarMovie{}
+	for rows.Next() {
+		var movie SimilarMovie
+		var shared []string
+		var original Movie
+		err := rows.Scan(
+			&movie.ID,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			&movie.AverageRating,
+			&movie.Score,
+			&movie.Scores.Genres,
+			&movie.Scores.Year,
+			&movie.Scores.Runtime,
+			&movie.Scores.Rating,
+			pq.Array(&shared),
+			&original.Year,
+			&original.Runtime,
+			&original.AverageRating,
+		)
+		if err != nil {
+			return nil, err
+		}
+		movie.Reasons = similarityReasons(&original, &movie, shared)
+		similar = append(similar, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return similar, nil
+}
+
+// Refresh recomputes the similarity scores. Reads carry on against the old
+// scores while it runs
+func (m *SimilarityModel) Refresh() error {
+	_, err := m.DB.Exec(`REFRESH MATERIALIZED VIEW CONCURRENTLY movie_similarities`)
+	return err
+}
+
+// similarityReasons() explains in words what the two movies have in common
+func similarityReasons(movie *Movie, similar *SimilarMovie, shared []string) []string {
+	reasons := []string{}
+
+	switch len(shared) {
+	case 0:
+	case 1:
+		reasons = append(reasons, fmt.Sprintf("shares the genre %s", shared[0]))
+	default:
+		reasons = append(reasons, fmt.Sprintf("shares the genres %s", strings.Join(shared, ", ")))
+	}
+
+	switch years := abs(movie.Year - similar.Year); {
+	case years == 0:
+		reasons = append(reasons, "released the same year")
+	case years == 1:
+		reasons = append(reasons, "released a year apart")
+	case years <= 5:
+		reasons = append(reasons, fmt.Sprintf("released %d years apart", years))
+	}
+
+	switch minutes := abs(int32(movie.Runtime - similar.Runtime)); {
+	case minutes == 0:
+		reasons = append(reasons, "same runtime")
+	case minutes <= 15:
+		reasons = append(reasons, fmt.Sprintf("runtimes within %d mins", minutes))
+	}
+
+	if movie.AverageRating != nil && similar.AverageRating != nil && math.Abs(*movie.AverageRating-*similar.AverageRating) <= 1 {
+		reasons = append(reasons, fmt.Sprintf("similar average rating (%.1f vs %.1f)", *similar.AverageRating, *movie.AverageRating))
+	}
+
+	return reasons
+}
+
+func abs(n int32) int32 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+type MockSimilarityModel struct{}
+
+func (m MockSimilarityModel) Similar(movieID int64, limit int) ([]*SimilarMovie, error) {
+	return nil, nil
+}
+
+func (m MockSimilarityModel) Refresh() error {
+	return nil
+}
@@ -0,0 +1,294 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// StatsTTL is how long catalogue statistics are reused before they are worked
+// out again, per filter
+const StatsTTL = 30 * time.Second
+
+// statsCacheSize is how many filters' statistics are kept at most. Only the
+// catalogue as a whole and genre filters are cached, and genres can be combined
+// freely, so the oldest statistics make way when it is full
+const statsCacheSize = 64
+
+// StatsFilter narrows down the movies statistics are worked out for, with the
+// same meaning as the title, genres, person and release filters of the movie
+// listing
+type StatsFilter struct {
+	Title    string
+	Genres   []string
+	PersonID int64
+	Release  ReleaseFilter
+}
+
+// MovieStats describes the movies outside the trash that match a StatsFilter
+type MovieStats struct {
+	Total       int64           `json:"total"`
+	ByGenre     []GenreCount    `json:"by_genre"`
+	ByDecade    []DecadeCount   `json:"by_decade"`
+	ByYear      []YearCount     `json:"by_year"`
+	Runtime     RuntimeStats    `json:"runtime"`
+	Activity    []ActivityCount `json:"activity"`
+	GeneratedAt time.Time       `json:"generated_at"`
+}
+
+type GenreCount struct {
+	Genre string `json:"genre"`
+	Count int64  `json:"count"`
+}
+
+type DecadeCount struct {
+	Decade int32 `json:"decade"`
+	Count  int64 `json:"count"`
+}
+
+type YearCount struct {
+	Year  int32 `json:"year"`
+	Count int64 `json:"count"`
+}
+
+// RuntimeStats summarizes the runtimes in minutes. Everything is nil when no
+// movie matched
+type RuntimeStats struct {
+	Min    *int32   `json:"min"`
+	P25    *float64 `json:"p25"`
+	Median *float64 `json:"median"`
+	P75    *float64 `json:"p75"`
+	P90    *float64 `json:"p90"`
+	Max    *int32   `json:"max"`
+	Mean   *float64 `json:"mean"`
+}
+
+// ActivityCount is how many revisions the movies got in a month, in total and
+// by action (create, update, delete, ...)
+type ActivityCount struct {
+	Month   string           `json:"month"`
+	Edits   int64            `json:"edits"`
+	Actions map[string]int64 `json:"actions"`
+}
+
+// statsActivityMonths is how many months of edit activity are reported,
+// including the current one
+const statsActivityMonths = 12
+
+// filteredMoviesCTE selects the movies outside the trash that match the same
+// title ($1), genres ($2), person ($3) and release ($4 to $6) conditions as the
+// movie listing, for queries that aggregate over them
+var filteredMoviesCTE = `
+    WITH filtered AS (
+        SELECT id, year, runtime, genres
+        FROM movies
+        WHERE deleted_at IS NULL
+        AND (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
+        AND (genres @> $2 OR $2 = '{}')
+        AND (id IN (SELECT movie_id FROM credits WHERE person_id = $3) OR $3 = 0)
+        ` + releaseCondition(4) + `
+    )`
+
+// Define a StatsModel struct which wraps a sql.DB connection pool and keeps
+// recently worked out statistics
+type StatsModel struct {
+	DB *sql.DB
+
+	mu    sync.Mutex
+	cache map[string]*MovieStats
+}
+
+// cacheable() reports whether statistics for the filter are worth keeping:
+// those for the whole catalogue or a genre are asked for over and over, while
+// a title, person or release filter is rarely asked for twice
+func (f StatsFilter) cacheable() bool {
+	return f.Title == "" && f.PersonID == 0 && f.Release == (ReleaseFilter{})
+}
+
+// MovieStats returns statistics for the movies matching filter, from the cache
+// if they were worked out in the last StatsTTL
+func (m *StatsModel) MovieStats(filter StatsFilter) (*MovieStats, error) {
+	if !filter.cacheable() {
+		return m.movieStats(filter)
+	}
+
+	key := fmt.Sprintf("%q", filter.Genres)
+	if cached := m.cached(key); cached != nil {
+		return cached, nil
+	}
+
+	stats, err := m.movieStats(filter)
+	if err != nil {
+		return nil, err
+	}
+	m.remember(key, stats)
+	return stats, nil
+}
+
+// cached() returns the statistics kept for key, or nil if there are none that
+// were worked out in the last StatsTTL
+func (m *StatsModel) cached(key string) *MovieStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cached, ok := m.cache[key]
+	if !ok || time.Since(cached.GeneratedAt) >= StatsTTL {
+		return nil
+	}
+	return cached
+}
+
+// remember() keeps stats for key, first dropping whatever has gone stale and,
+// if the cache is still full, the oldest statistics
+func (m *StatsModel) remember(key string, stats *MovieStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.cache == nil {
+		m.cache = make(map[string]*MovieStats)
+	}
+	for k, s := range m.cache {
+		if time.Since(s.GeneratedAt) >= StatsTTL {
+			delete(m.cache, k)
+		}
+	}
+	if _, ok := m.cache[key]; !ok && len(m.cache) >= statsCacheSize {
+		var oldest string
+		for k, s := range m.cache {
+			if oldest == "" || s.GeneratedAt.Before(m.cache[oldest].GeneratedAt) {
+				oldest = k
+			}
+		}
+		delete(m.cache, oldest)
+	}
+	m.cache[key] = stats
+}
+
+// movieStats() runs the aggregate queries in one read-only transaction, so
+// that they all see the same movies
+func (m *StatsModel) movieStats(filter StatsFilter) (*MovieStats, error) {
+	tx, err := m.DB.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	args := append([]interface{}{filter.Title, pq.Array(filter.Genres), filter.PersonID}, filter.Release.args()...)
+
+	stats := &MovieStats{
+		ByGenre:     []GenreCount{},
+		ByDecade:    []DecadeCount{},
+		ByYear:      []YearCount{},
+		Activity:    []ActivityCount{},
+		GeneratedAt: time.Now(),
+	}
+
+	var percentiles pq.Float64Array
+	err = tx.QueryRow(filteredMoviesCTE+`
+    SELECT count(*), min(runtime), max(runtime), avg(runtime)::float8,
+        percentile_cont(ARRAY[0.25, 0.5, 0.75, 0.9]) WITHIN GROUP (ORDER BY runtime)
+    FROM filtered`, args...).Scan(
+		&stats.Total,
+		&stats.Runtime.Min,
+		&stats.Runtime.Max,
+		&stats.Runtime.Mean,
+		&percentiles,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(percentiles) == 4 {
+		stats.Runtime.P25, stats.Runtime.Median, stats.Runtime.P75, stats.Runtime.P90 = &percentiles[0], &percentiles[1], &percentiles[2], &percentiles[3]
+	}
+
+	rows, err := tx.Query(filteredMoviesCTE+`
+    SELECT genre, count(*)
+    FROM filtered, unnest(genres) AS genre
+    GROUP BY genre
+    ORDER BY count(*) DESC, genre`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var count GenreCount
+		if err := rows.Scan(&count.Genre, &count.Count); err != nil {
+			return nil, err
+		}
+		stats.ByGenre = append(stats.ByGenre, count)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// decades are added up from the years, which come back in order
+	rows, err = tx.Query(filteredMoviesCTE+`
+    SELECT year, count(*)
+    FROM filtered
+    GROUP BY year
+    ORDER BY year`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var count YearCount
+		if err := rows.Scan(&count.Year, &count.Count); err != nil {
+			return nil, err
+		}
+		stats.ByYear = append(stats.ByYear, count)
+
+		decade := count.Year - count.Year%10
+		if n := len(stats.ByDecade); n > 0 && stats.ByDecade[n-1].Decade == decade {
+			stats.ByDecade[n-1].Count += count.Count
+		} else {
+			stats.ByDecade = append(stats.ByDecade, DecadeCount{Decade: decade, Count: count.Count})
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// the baseline revisions were made by the migration, not by anyone editing
+	rows, err = tx.Query(filteredMoviesCTE+`
+    SELECT to_char(date_trunc('month', r.created_at), 'YYYY-MM'), r.action, count(*)
+    FROM movie_revisions r
+    WHERE r.movie_id IN (SELECT id FROM filtered)
+    AND r.action <> 'baseline'
+    AND r.created_at >= date_trunc('month', NOW()) - make_interval(months => $7 - 1)
+    GROUP BY 1, 2
+    ORDER BY 1, 2`, append(args, statsActivityMonths)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var month, action string
+		var count int64
+		if err := rows.Scan(&month, &action, &count); err != nil {
+			return nil, err
+		}
+		n := len(stats.Activity)
+		if n == 0 || stats.Activity[n-1].Month != month {
+			stats.Activity = append(stats.Activity, ActivityCount{Month: month, Actions: make(map[string]int64)})
+			n++
+		}
+		stats.Activity[n-1].Edits += count
+		stats.Activity[n-1].Actions[action] = count
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+type MockStatsModel struct{}
+
+func (m MockStatsModel) MovieStats(filter StatsFilter) (*MovieStats, error) {
+	return nil, nil
+}
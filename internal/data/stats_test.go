@@ -0,0 +1,57 @@
+package data
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestStatsFilterCacheable(t *testing.T) {
+	from := NewDate(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		name   string
+		filter StatsFilter
+		want   bool
+	}{
+		{"whole catalogue", StatsFilter{}, true},
+		{"genres", StatsFilter{Genres: []string{"drama", "comedy"}}, true},
+		{"title", StatsFilter{Title: "moana"}, false},
+		{"person", StatsFilter{PersonID: 3}, false},
+		{"release country", StatsFilter{Release: ReleaseFilter{Country: "US"}}, false},
+		{"release window", StatsFilter{Genres: []string{"drama"}, Release: ReleaseFilter{From: &from}}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.filter.cacheable(); got != tt.want {
+			t.Errorf("%s: cacheable() = %v; want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStatsCache(t *testing.T) {
+	m := &StatsModel{}
+	start := time.Now()
+
+	for i := range statsCacheSize + 10 {
+		m.remember(fmt.Sprint(i), &MovieStats{GeneratedAt: start.Add(time.Duration(i) * time.Millisecond)})
+	}
+	if len(m.cache) != statsCacheSize {
+		t.Errorf("cache holds %d entries; want %d", len(m.cache), statsCacheSize)
+	}
+	if m.cached("0") != nil || m.cached("9") != nil {
+		t.Error("oldest entries were kept")
+	}
+	if m.cached("10") == nil || m.cached(fmt.Sprint(statsCacheSize+9)) == nil {
+		t.Error("newest entries were dropped")
+	}
+
+	m.remember("stale", &MovieStats{GeneratedAt: time.Now().Add(-StatsTTL)})
+	if m.cached("stale") != nil {
+		t.Error("stale entry was returned")
+	}
+	m.remember("fresh", &MovieStats{GeneratedAt: time.Now()})
+	if _, ok := m.cache["stale"]; ok {
+		t.Error("stale entry was not dropped")
+	}
+}
@@ -0,0 +1,252 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+// DefaultLanguage is the language movies.title is written in. It needs no
+// translation, and a fallback chain that reaches it ends there
+const DefaultLanguage = "en"
+
+// languageTagRX matches the BCP 47 tags translations are kept under: a language,
+// then optionally a script and a region (e.g. "sr-Latn-RS"). Variants and
+// extensions aren't supported
+var languageTagRX = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z]{4})?(-([a-zA-Z]{2}|[0-9]{3}))?$`)
+
+// CanonicalLanguage returns a language tag in its canonical case ("pt-BR",
+// "zh-Hant"), and whether it is a tag translations can have
+func CanonicalLanguage(tag string) (string, bool) {
+	if !languageTagRX.MatchString(tag) {
+		return "", false
+	}
+
+	subtags := strings.Split(tag, "-")
+	subtags[0] = strings.ToLower(subtags[0])
+	for i := 1; i < len(subtags); i++ {
+		if len(subtags[i]) == 4 {
+			subtags[i] = strings.ToUpper(subtags[i][:1]) + strings.ToLower(subtags[i][1:])
+		} else {
+			subtags[i] = strings.ToUpper(subtags[i])
+		}
+	}
+	return strings.Join(subtags, "-"), true
+}
+
+// LanguageFallbacks returns the languages to try, in order, for a list of
+// preferred language tags: each tag followed by ever shorter forms of it, so
+// that "pt-BR" falls back to "pt" (the lookup scheme of RFC 4647). Tags that
+// can't be used are skipped, and the chain stops at DefaultLanguage
+func LanguageFallbacks(preferred []string) []string {
+	chain := []string{}
+	seen := make(map[string]bool)
+	for _, tag := range preferred {
+		tag, ok := CanonicalLanguage(tag)
+		if !ok {
+			continue
+		}
+		for {
+			if tag == DefaultLanguage {
+				return chain
+			}
+			if !seen[tag] {
+				seen[tag] = true
+				chain = append(chain, tag)
+			}
+			i := strings.LastIndex(tag, "-")
+			if i < 0 {
+				break
+			}
+			tag = tag[:i]
+		}
+	}
+	return chain
+}
+
+// Translation is a movie's title in another language
+type Translation struct {
+	MovieID   int64     `json:"movie_id"`
+	Language  string    `json:"language"`
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Title     string    `json:"title"`
+	Version   int32     `json:"version"`
+}
+
+// ValidateTranslation checks a translation, putting its language in canonical case
+func ValidateTranslation(v *validator.Validator, translation *Translation) {
+	language, ok := CanonicalLanguage(translation.Language)
+	v.Check(ok, "language", "must be a BCP 47 language tag such as fr or pt-BR")
+	v.Check(language != DefaultLanguage, "language", "must not be the default language, which the movie title is already in")
+	translation.Language = language
+
+	v.Check(translation.Title != "", "title", "must be provided")
+	v.Check(len(translation.Title) <= 500, "title", "must not be more than 500 bytes long")
+}
+
+// Define a TranslationModel struct which wraps a sql.DB connection pool
+type TranslationModel struct {
+	DB *sql.DB
+}
+
+// GetAll returns the translations of a movie by language
+func (m *TranslationModel) GetAll(movieID int64) ([]*Translation, error) {
+	query := `
+    SELECT movie_id, language, created_at, updated_at, title, version
+    FROM movie_translations
+    WHERE movie_id = $1
+    ORDER BY language`
+
+	rows, err := m.DB.Query(query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	translations := []*Translation{}
+	for rows.Next() {
+		translation, err := scanTranslation(rows)
+		if err != nil {
+			return nil, err
+		}
+		translations = append(translations, translation)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return translations, nil
+}
+
+// Put adds or replaces the translation of a movie into a language, and
+// reports whether it was added. A movie that doesn't exist or is in the trash
+// gives ErrorRecordNotFound
+func (m *TranslationModel) Put(translation *Translation) (bool, error) {
+	query := `
+    INSERT INTO movie_translations (movie_id, language, title)
+    SELECT id, $2, $3
+    FROM movies
+    WHERE id = $1 AND deleted_at IS NULL
+    ON CONFLICT (movie_id, language) DO UPDATE
+    SET title = EXCLUDED.title, updated_at = NOW(), version = movie_translations.version + 1
+    RETURNING created_at, updated_at, version, xmax = 0`
+
+	var created bool
+	err := m.DB.QueryRow(query, translation.MovieID, translation.Language, translation.Title).Scan(
+		&translation.CreatedAt,
+		&translation.UpdatedAt,
+		&translation.Version,
+		&created,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, ErrorRecordNotFound
+		default:
+			return false, err
+		}
+	}
+	return created, nil
+}
+
+func (m *TranslationModel) Delete(movieID int64, language string) error {
+	result, err := m.DB.Exec(`DELETE FROM movie_translations WHERE movie_id = $1 AND language = $2`, movieID, language)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrorRecordNotFound
+	}
+	return nil
+}
+
+// Best returns the translation of a movie into the first of the languages it
+// has one for, or nil if it has none of them
+func (m *TranslationModel) Best(movieID int64, languages []string) (*Translation, error) {
+	translations, err := m.BestFor([]int64{movieID}, languages)
+	if err != nil {
+		return nil, err
+	}
+	return translations[movieID], nil
+}
+
+// BestFor is Best() for several movies at once, keyed by movie id. Movies
+// without a translation into any of the languages are left out
+func (m *TranslationModel) BestFor(ids []int64, languages []string) (map[int64]*Translation, error) {
+	translations := make(map[int64]*Translation)
+	if len(ids) == 0 || len(languages) == 0 {
+		return translations, nil
+	}
+
+	query := `
+    SELECT DISTINCT ON (movie_id) movie_id, language, created_at, updated_at, title, version
+    FROM movie_translations
+    WHERE movie_id = ANY($1) AND language = ANY($2)
+    ORDER BY movie_id, array_position($2, language)`
+
+	rows, err := m.DB.Query(query, pq.Array(ids), pq.Array(languages))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		translation, err := scanTranslation(rows)
+		if err != nil {
+			return nil, err
+		}
+		translations[translation.MovieID] = translation
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return translations, nil
+}
+
+// scanTranslation() reads a translation from a row of the columns GetAll() selects
+func scanTranslation(row rowScanner) (*Translation, error) {
+	var translation Translation
+	err := row.Scan(
+		&translation.MovieID,
+		&translation.Language,
+		&translation.CreatedAt,
+		&translation.UpdatedAt,
+		&translation.Title,
+		&translation.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &translation, nil
+}
+
+type MockTranslationModel struct{}
+
+func (m MockTranslationModel) GetAll(movieID int64) ([]*Translation, error) {
+	return nil, nil
+}
+
+func (m MockTranslationModel) Put(translation *Translation) (bool, error) {
+	return false, nil
+}
+
+func (m MockTranslationModel) Delete(movieID int64, language string) error {
+	return nil
+}
+
+func (m MockTranslationModel) Best(movieID int64, languages []string) (*Translation, error) {
+	return nil, nil
+}
+
+func (m MockTranslationModel) BestFor(ids []int64, languages []string) (map[int64]*Translation, error) {
+	return nil, nil
+}
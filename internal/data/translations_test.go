@@ -0,0 +1,90 @@
+package data
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"greenlight.alexedwards.net/internal/validator"
+)
+
+func TestCanonicalLanguage(t *testing.T) {
+	tests := []struct {
+		tag    string
+		want   string
+		wantOK bool
+	}{
+		{"en", "en", true},
+		{"EN", "en", true},
+		{"pt-br", "pt-BR", true},
+		{"zh-hant", "zh-Hant", true},
+		{"SR-LATN-rs", "sr-Latn-RS", true},
+		{"es-419", "es-419", true},
+		{"fil", "fil", true},
+		{"", "", false},
+		{"e", "", false},
+		{"english", "", false},
+		{"en_GB", "", false},
+		{"en-", "", false},
+		{"en-GB-oxendict", "", false},
+		{"de-1996", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := CanonicalLanguage(tt.tag)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("CanonicalLanguage(%q) = %q, %v; want %q, %v", tt.tag, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestLanguageFallbacks(t *testing.T) {
+	tests := []struct {
+		name      string
+		preferred []string
+		want      []string
+	}{
+		{"none", nil, []string{}},
+		{"shorter forms follow each tag", []string{"sr-Latn-RS"}, []string{"sr-Latn-RS", "sr-Latn", "sr"}},
+		{"several tags", []string{"pt-BR", "fr"}, []string{"pt-BR", "pt", "fr"}},
+		{"canonical case", []string{"PT-br"}, []string{"pt-BR", "pt"}},
+		{"duplicates once", []string{"pt-BR", "pt-PT", "pt"}, []string{"pt-BR", "pt", "pt-PT"}},
+		{"stops at the default language", []string{"fr", "en", "de"}, []string{"fr"}},
+		{"default language region", []string{"en-GB", "de"}, []string{"en-GB"}},
+		{"unusable tags skipped", []string{"klingon!", "de"}, []string{"de"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LanguageFallbacks(tt.preferred); !slices.Equal(got, tt.want) {
+				t.Errorf("LanguageFallbacks(%q) = %q; want %q", tt.preferred, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTranslation(t *testing.T) {
+	tests := []struct {
+		name         string
+		translation  Translation
+		wantLanguage string
+		wantErrors   []string
+	}{
+		{"valid", Translation{Language: "pt-br", Title: "A Origem"}, "pt-BR", nil},
+		{"bad language", Translation{Language: "portuguese", Title: "A Origem"}, "", []string{"language"}},
+		{"default language", Translation{Language: "EN", Title: "Inception"}, "en", []string{"language"}},
+		{"missing title", Translation{Language: "fr"}, "fr", []string{"title"}},
+		{"long title", Translation{Language: "fr", Title: strings.Repeat("a", 501)}, "fr", []string{"title"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateTranslation(v, &tt.translation)
+			assertValidationErrors(t, v, tt.wantErrors)
+			if tt.translation.Language != tt.wantLanguage {
+				t.Errorf("language = %q; want %q", tt.translation.Language, tt.wantLanguage)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+)
+
+// Disk stores files in a directory on the local filesystem, one file per key.
+// The content type isn't kept, so it is worked out from the key's extension
+type Disk struct {
+	Root string
+}
+
+// NewDisk returns a Disk storing files in root, creating the directory if needed
+func NewDisk(root string) (*Disk, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &Disk{Root: root}, nil
+}
+
+// Put writes the file to a temporary name first and renames it into place, so
+// a reader never sees half a file
+func (d *Disk) Put(key string, r io.Reader, contentType string) error {
+	if !ValidKey(key) {
+		return ErrInvalidKey
+	}
+
+	tmp, err := os.CreateTemp(d.Root, ".upload-*")
+	if err != nil {
+		return err
+	}
+	// removing after a successful rename does nothing
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(d.Root, key))
+}
+
+func (d *Disk) Get(key string) (io.ReadCloser, *Object, error) {
+	if !ValidKey(key) {
+		return nil, nil, ErrNotFound
+	}
+
+	f, err := os.Open(filepath.Join(d.Root, key))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, ErrNotFound
+		}
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	object := &Object{
+		Key:          key,
+		Size:         info.Size(),
+		ContentType:  mime.TypeByExtension(filepath.Ext(key)),
+		LastModified: info.ModTime(),
+	}
+	return f, object, nil
+}
+
+func (d *Disk) Delete(key string) error {
+	if !ValidKey(key) {
+		return ErrInvalidKey
+	}
+
+	err := os.Remove(filepath.Join(d.Root, key))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
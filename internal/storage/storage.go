@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"regexp"
+	"time"
+)
+
+// ErrNotFound is returned when there is no file under a key
+var ErrNotFound = errors.New("file not found")
+
+// ErrInvalidKey is returned for keys a store can't keep files under
+var ErrInvalidKey = errors.New("invalid key")
+
+// keyRX matches the keys files can be stored under: a flat name of letters,
+// digits, dots, dashes and underscores, which every backend can use as it is
+var keyRX = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]{0,254}$`)
+
+// Storage keeps files under keys, like a bucket of an object store such as
+// S3: a file is written whole, read back whole and replaced by writing it
+// again. Disk keeps them on the local filesystem
+type Storage interface {
+	// Put stores the contents of r under key, replacing any file already there
+	Put(key string, r io.Reader, contentType string) error
+	// Get opens the file under key. The caller must close it
+	Get(key string) (io.ReadCloser, *Object, error)
+	// Delete removes the file under key. Deleting a missing file is not an error
+	Delete(key string) error
+}
+
+// Object describes a stored file
+type Object struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// ValidKey reports whether files can be stored under key
+func ValidKey(key string) bool {
+	return keyRX.MatchString(key)
+}
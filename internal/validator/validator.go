@@ -5,6 +5,42 @@ import "regexp"
 // regex for checking email format
 var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
+// regexes for checking the format of movie identifiers from other databases
+var (
+	// IMDb title ids, e.g. tt0111161
+	IMDbIDRX = regexp.MustCompile(`^tt[0-9]{7,10}$`)
+	// TMDB movie ids are plain positive numbers, e.g. 278
+	TMDBIDRX = regexp.MustCompile(`^[1-9][0-9]{0,9}$`)
+	// Wikidata item ids, e.g. Q172241
+	WikidataIDRX = regexp.MustCompile(`^Q[1-9][0-9]{0,11}$`)
+)
+
+// regex for checking ISO 3166-1 alpha-2 country codes, e.g. GB
+var CountryCodeRX = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// RatingSystems holds the age ratings each country's film classification body
+// gives out, keyed by country code. Countries not listed may use any rating
+var RatingSystems = map[string][]string{
+	"AU": {"G", "PG", "M", "MA15+", "R18+", "X18+"},
+	"BR": {"L", "10", "12", "14", "16", "18"},
+	"DE": {"FSK 0", "FSK 6", "FSK 12", "FSK 16", "FSK 18"},
+	"ES": {"A", "7", "12", "16", "18", "X"},
+	"FR": {"U", "10", "12", "16", "18"},
+	"GB": {"U", "PG", "12A", "12", "15", "18", "R18"},
+	"IE": {"G", "PG", "12A", "15A", "16", "18"},
+	"IN": {"U", "UA", "UA 7+", "UA 13+", "UA 16+", "A", "S"},
+	"JP": {"G", "PG12", "R15+", "R18+"},
+	"NL": {"AL", "6", "9", "12", "14", "16", "18"},
+	"US": {"G", "PG", "PG-13", "R", "NC-17"},
+}
+
+// returns true if certification is one the rating system of the country gives
+// out, or if there is no known rating system for the country
+func Certified(country, certification string) bool {
+	ratings, ok := RatingSystems[country]
+	return !ok || In(certification, ratings...)
+}
+
 type Validator struct {
 	Errors map[string]string
 }
@@ -0,0 +1,50 @@
+package validator
+
+import "testing"
+
+func TestCertified(t *testing.T) {
+	tests := []struct {
+		country       string
+		certification string
+		want          bool
+	}{
+		{"US", "PG-13", true},
+		{"US", "12A", false},
+		{"US", "pg-13", false},
+		{"GB", "12A", true},
+		{"DE", "FSK 16", true},
+		{"DE", "16", false},
+		{"AU", "MA15+", true},
+		{"US", "", false},
+		{"SE", "15", true},
+		{"SE", "anything", true},
+	}
+
+	for _, tt := range tests {
+		if got := Certified(tt.country, tt.certification); got != tt.want {
+			t.Errorf("Certified(%q, %q) = %v; want %v", tt.country, tt.certification, got, tt.want)
+		}
+	}
+}
+
+func TestCountryCodeRX(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{"GB", true},
+		{"US", true},
+		{"gb", false},
+		{"GBR", false},
+		{"G", false},
+		{"G1", false},
+		{"GB\n", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := Matches(tt.code, CountryCodeRX); got != tt.want {
+			t.Errorf("Matches(%q, CountryCodeRX) = %v; want %v", tt.code, got, tt.want)
+		}
+	}
+}
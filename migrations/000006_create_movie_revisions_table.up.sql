@@ -0,0 +1,51 @@
+CREATE TABLE IF NOT EXISTS movie_revisions (
+    id bigserial PRIMARY KEY,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    version integer NOT NULL,
+    action text NOT NULL,
+    actor text,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    snapshot jsonb NOT NULL,
+    UNIQUE (movie_id, version)
+);
+
+-- The application passes who made the change (and optionally the action) in
+-- transaction-local settings, which the trigger reads back.
+CREATE OR REPLACE FUNCTION record_movie_revision() RETURNS trigger AS $$
+DECLARE
+    revision_action text := nullif(current_setting('greenlight.action', true), '');
+BEGIN
+    IF revision_action IS NULL THEN
+        IF TG_OP = 'INSERT' THEN
+            revision_action := 'create';
+        ELSIF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+            revision_action := 'delete';
+        ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+            revision_action := 'restore';
+        ELSE
+            revision_action := 'update';
+        END IF;
+    END IF;
+
+    INSERT INTO movie_revisions (movie_id, version, action, actor, snapshot)
+    VALUES (NEW.id, NEW.version, revision_action, nullif(current_setting('greenlight.actor', true), ''), to_jsonb(NEW));
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER movies_revision_insert
+    AFTER INSERT ON movies
+    FOR EACH ROW EXECUTE FUNCTION record_movie_revision();
+
+-- only changes that bump the version are revisions
+CREATE TRIGGER movies_revision_update
+    AFTER UPDATE ON movies
+    FOR EACH ROW WHEN (OLD.version IS DISTINCT FROM NEW.version)
+    EXECUTE FUNCTION record_movie_revision();
+
+-- existing movies start their history at their current version
+INSERT INTO movie_revisions (movie_id, version, action, snapshot)
+SELECT id, version, 'baseline', to_jsonb(movies)
+FROM movies
+ON CONFLICT (movie_id, version) DO NOTHING;
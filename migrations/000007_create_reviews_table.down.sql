@@ -0,0 +1,4 @@
+ALTER TABLE movies DROP COLUMN IF EXISTS average_rating;
+ALTER TABLE movies DROP COLUMN IF EXISTS rating_sum;
+ALTER TABLE movies DROP COLUMN IF EXISTS rating_count;
+DROP TABLE IF EXISTS reviews;
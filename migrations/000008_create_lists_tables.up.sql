@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS lists (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    owner text NOT NULL,
+    name text NOT NULL,
+    public boolean NOT NULL DEFAULT false,
+    slug text NOT NULL UNIQUE,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS lists_owner_idx ON lists (owner);
+
+-- Positions run from 1 without gaps. The unique constraint is deferrable so
+-- that a single UPDATE can shift a run of items by one.
+CREATE TABLE IF NOT EXISTS list_items (
+    list_id bigint NOT NULL REFERENCES lists ON DELETE CASCADE,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    position integer NOT NULL CHECK (position > 0),
+    added_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    watched_on date,
+    PRIMARY KEY (list_id, movie_id),
+    UNIQUE (list_id, position) DEFERRABLE INITIALLY IMMEDIATE
+);
+
+CREATE INDEX IF NOT EXISTS list_items_movie_id_idx ON list_items (movie_id);
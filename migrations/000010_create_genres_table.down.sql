@@ -0,0 +1,2 @@
+-- movies keep their genre slugs; the original spellings can't be recovered
+DROP TABLE IF EXISTS genres;
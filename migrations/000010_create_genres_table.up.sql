@@ -0,0 +1,67 @@
+CREATE TABLE IF NOT EXISTS genres (
+    slug text PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    aliases text[] NOT NULL DEFAULT '{}',
+    version integer NOT NULL DEFAULT 1
+);
+
+-- Genre names are matched by key: lower case with every run of other
+-- characters turned into a hyphen, so "Sci-Fi", "sci fi" and "SCI_FI" are all
+-- "sci-fi". Slugs and aliases are stored as keys. This is the same as
+-- data.GenreKey() and is only needed here for the backfill.
+CREATE FUNCTION pg_temp.genre_key(name text) RETURNS text AS $$
+    SELECT trim(both '-' from regexp_replace(lower(name), '[^a-z0-9]+', '-', 'g'))
+$$ LANGUAGE sql IMMUTABLE;
+
+-- the common genres, with the spellings already known to be in use
+INSERT INTO genres (slug, name, aliases) VALUES
+    ('action', 'Action', '{}'),
+    ('adventure', 'Adventure', '{}'),
+    ('animation', 'Animation', '{animated,cartoon}'),
+    ('comedy', 'Comedy', '{comedies}'),
+    ('crime', 'Crime', '{}'),
+    ('documentary', 'Documentary', '{doc,docs}'),
+    ('drama', 'Drama', '{}'),
+    ('family', 'Family', '{}'),
+    ('fantasy', 'Fantasy', '{}'),
+    ('history', 'History', '{historical}'),
+    ('horror', 'Horror', '{}'),
+    ('music', 'Music', '{musical}'),
+    ('mystery', 'Mystery', '{}'),
+    ('romance', 'Romance', '{romantic}'),
+    ('science-fiction', 'Science Fiction', '{sci-fi,scifi,sf}'),
+    ('thriller', 'Thriller', '{}'),
+    ('war', 'War', '{}'),
+    ('western', 'Western', '{}')
+ON CONFLICT (slug) DO NOTHING;
+
+-- every other genre already in use becomes a genre of its own, named after
+-- its most common spelling
+INSERT INTO genres (slug, name)
+SELECT DISTINCT ON (key) key, name
+FROM (
+    SELECT pg_temp.genre_key(name) AS key, name, count(*) AS uses
+    FROM movies, unnest(genres) AS name
+    GROUP BY name
+) used
+WHERE key <> ''
+AND NOT EXISTS (SELECT 1 FROM genres WHERE slug = key OR key = ANY(aliases))
+ORDER BY key, uses DESC, name
+ON CONFLICT (slug) DO NOTHING;
+
+-- rewrite the arrays to slugs, dropping duplicates that were spelled differently
+UPDATE movies m
+SET genres = (
+    SELECT array_agg(slug ORDER BY position)
+    FROM (
+        SELECT g.slug, min(t.position) AS position
+        FROM unnest(m.genres) WITH ORDINALITY AS t(name, position)
+        JOIN genres g ON g.slug = pg_temp.genre_key(t.name) OR pg_temp.genre_key(t.name) = ANY(g.aliases)
+        GROUP BY g.slug
+    ) resolved
+)
+WHERE EXISTS (
+    SELECT 1 FROM unnest(m.genres) AS name
+    JOIN genres g ON g.slug = pg_temp.genre_key(name) OR pg_temp.genre_key(name) = ANY(g.aliases)
+);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS collections (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    version integer NOT NULL DEFAULT 1
+);
+
+-- Same ordering rules as list_items: positions from 1 without gaps, and a
+-- movie at most once per collection.
+CREATE TABLE IF NOT EXISTS collection_movies (
+    collection_id bigint NOT NULL REFERENCES collections ON DELETE CASCADE,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    position integer NOT NULL CHECK (position > 0),
+    PRIMARY KEY (collection_id, movie_id),
+    UNIQUE (collection_id, position) DEFERRABLE INITIALLY IMMEDIATE
+);
+
+CREATE INDEX IF NOT EXISTS collection_movies_movie_id_idx ON collection_movies (movie_id);
@@ -0,0 +1,17 @@
+-- Each edge reads "movie_id is a <type> of related_id". Only one direction of
+-- each pair of inverse types is stored (a prequel is saved as the other movie
+-- being a sequel); the inverse is worked out when reading.
+CREATE TABLE IF NOT EXISTS movie_relations (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    related_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    type text NOT NULL CHECK (type IN ('sequel', 'remake', 'spin_off')),
+    CHECK (movie_id <> related_id)
+);
+
+-- two movies are related at most once, whichever way round
+CREATE UNIQUE INDEX IF NOT EXISTS movie_relations_pair_idx
+    ON movie_relations (LEAST(movie_id, related_id), GREATEST(movie_id, related_id));
+CREATE INDEX IF NOT EXISTS movie_relations_movie_id_idx ON movie_relations (movie_id);
+CREATE INDEX IF NOT EXISTS movie_relations_related_id_idx ON movie_relations (related_id);
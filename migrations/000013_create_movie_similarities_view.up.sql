@@ -0,0 +1,39 @@
+-- Precomputed "you might also like" scores. Only movies sharing a genre are
+-- compared, and each movie keeps its 50 best matches. The score weighs genre
+-- overlap (Jaccard), year and runtime closeness and, when both movies have
+-- been rated, rating closeness; without ratings the other weights are scaled
+-- up to make up for it. The API refreshes the view in the background.
+CREATE MATERIALIZED VIEW IF NOT EXISTS movie_similarities AS
+WITH live AS (
+    SELECT id, year, runtime, genres, average_rating
+    FROM movies
+    WHERE deleted_at IS NULL
+), pairs AS (
+    SELECT a.id AS movie_id, b.id AS similar_id,
+        ARRAY(SELECT g FROM unnest(a.genres) g WHERE g = ANY(b.genres)) AS shared_genres,
+        cardinality(ARRAY(SELECT DISTINCT g FROM unnest(a.genres || b.genres) g)) AS genre_union,
+        greatest(0, 1 - abs(a.year - b.year) / 20.0) AS year_score,
+        greatest(0, 1 - abs(a.runtime - b.runtime)::numeric / greatest(a.runtime, b.runtime, 1)) AS runtime_score,
+        1 - abs(a.average_rating - b.average_rating) / 9 AS rating_score
+    FROM live a
+    JOIN live b ON b.id <> a.id AND b.genres && a.genres
+), scored AS (
+    SELECT movie_id, similar_id, shared_genres,
+        round(cardinality(shared_genres)::numeric / genre_union, 4) AS genre_score,
+        round(year_score, 4) AS year_score,
+        round(runtime_score, 4) AS runtime_score,
+        round(rating_score, 4) AS rating_score,
+        round((0.5 * cardinality(shared_genres) / genre_union + 0.2 * year_score + 0.15 * runtime_score
+            + 0.15 * coalesce(rating_score, 0)) / CASE WHEN rating_score IS NULL THEN 0.85 ELSE 1 END, 4) AS score
+    FROM pairs
+)
+SELECT movie_id, similar_id, score, genre_score, year_score, runtime_score, rating_score, shared_genres
+FROM (
+    SELECT *, row_number() OVER (PARTITION BY movie_id ORDER BY score DESC, similar_id) AS rank
+    FROM scored
+) ranked
+WHERE rank <= 50;
+
+-- the unique index lets the view be refreshed concurrently, without blocking reads
+CREATE UNIQUE INDEX IF NOT EXISTS movie_similarities_pair_idx ON movie_similarities (movie_id, similar_id);
+CREATE INDEX IF NOT EXISTS movie_similarities_score_idx ON movie_similarities (movie_id, score DESC);
@@ -0,0 +1,12 @@
+-- Titles of movies in other languages. The language is a BCP 47 tag in its
+-- canonical case (e.g. fr, pt-BR, zh-Hant-TW); movies.title itself is in the
+-- catalogue's default language.
+CREATE TABLE IF NOT EXISTS movie_translations (
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    language text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    title text NOT NULL,
+    version integer NOT NULL DEFAULT 1,
+    PRIMARY KEY (movie_id, language)
+);
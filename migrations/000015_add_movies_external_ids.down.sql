@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS movies_external_ids_idx;
+DROP INDEX IF EXISTS movies_external_ids_wikidata_key;
+DROP INDEX IF EXISTS movies_external_ids_tmdb_key;
+DROP INDEX IF EXISTS movies_external_ids_imdb_key;
+ALTER TABLE movies DROP CONSTRAINT IF EXISTS movies_external_ids_check;
+ALTER TABLE movies DROP COLUMN IF EXISTS external_ids;
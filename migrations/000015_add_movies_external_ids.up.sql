@@ -0,0 +1,14 @@
+-- Ids of the movie in other databases, keyed by source, e.g.
+-- {"imdb": "tt0111161", "tmdb": "278", "wikidata": "Q172241"}.
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS external_ids jsonb NOT NULL DEFAULT '{}';
+ALTER TABLE movies ADD CONSTRAINT movies_external_ids_check CHECK (jsonb_typeof(external_ids) = 'object');
+
+-- An id belongs to one movie, including movies in the trash, so that restoring
+-- a movie can't clash with another. The index names are how the application
+-- tells which source a duplicate was in.
+CREATE UNIQUE INDEX IF NOT EXISTS movies_external_ids_imdb_key ON movies ((external_ids->>'imdb')) WHERE external_ids ? 'imdb';
+CREATE UNIQUE INDEX IF NOT EXISTS movies_external_ids_tmdb_key ON movies ((external_ids->>'tmdb')) WHERE external_ids ? 'tmdb';
+CREATE UNIQUE INDEX IF NOT EXISTS movies_external_ids_wikidata_key ON movies ((external_ids->>'wikidata')) WHERE external_ids ? 'wikidata';
+
+-- for looking movies up by an id from any source
+CREATE INDEX IF NOT EXISTS movies_external_ids_idx ON movies USING GIN (external_ids jsonb_path_ops);
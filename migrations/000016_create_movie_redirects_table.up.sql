@@ -0,0 +1,17 @@
+-- A movie merged into another is deleted, and its id redirects to the movie it
+-- was merged into. Merging the target in turn repoints the redirects to it.
+CREATE TABLE IF NOT EXISTS movie_redirects (
+    movie_id bigint PRIMARY KEY,
+    target_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS movie_redirects_target_id_idx ON movie_redirects (target_id);
+
+-- The title as compared when looking for duplicates: lower case, without a
+-- leading article and with only letters and digits.
+CREATE OR REPLACE FUNCTION movie_title_key(title text) RETURNS text AS $$
+    SELECT regexp_replace(regexp_replace(lower(title), '^(the|a|an)\s+', ''), '[^[:alnum:]]+', '', 'g')
+$$ LANGUAGE sql IMMUTABLE PARALLEL SAFE;
+
+CREATE INDEX IF NOT EXISTS movies_title_key_idx ON movies (movie_title_key(title), year) WHERE deleted_at IS NULL;
@@ -0,0 +1,16 @@
+-- When and how a movie came out in each country, with the age rating it was
+-- given there (empty if unrated). A movie's year is kept equal to the year of
+-- its earliest release by the application.
+CREATE TABLE IF NOT EXISTS movie_releases (
+    id bigserial PRIMARY KEY,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    country text NOT NULL CHECK (country ~ '^[A-Z]{2}$'),
+    date date NOT NULL,
+    type text NOT NULL CHECK (type IN ('premiere', 'limited', 'theatrical', 'digital', 'physical', 'tv')),
+    certification text NOT NULL DEFAULT '',
+    version integer NOT NULL DEFAULT 1,
+    UNIQUE (movie_id, country, type)
+);
+
+CREATE INDEX IF NOT EXISTS movie_releases_country_date_idx ON movie_releases (country, date);
+CREATE INDEX IF NOT EXISTS movie_releases_date_idx ON movie_releases (date);
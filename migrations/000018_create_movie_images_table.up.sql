@@ -0,0 +1,18 @@
+-- Artwork for movies. The files are named after the SHA-256 of the uploaded
+-- bytes, so the same file uploaded twice is stored once; thumbnails lists the
+-- widths that resized copies were made at.
+CREATE TABLE IF NOT EXISTS movie_images (
+    id bigserial PRIMARY KEY,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    kind text NOT NULL CHECK (kind IN ('poster', 'backdrop', 'still')),
+    hash text NOT NULL CHECK (hash ~ '^[0-9a-f]{64}$'),
+    content_type text NOT NULL,
+    width integer NOT NULL CHECK (width > 0),
+    height integer NOT NULL CHECK (height > 0),
+    size bigint NOT NULL CHECK (size > 0),
+    thumbnails integer[] NOT NULL DEFAULT '{}',
+    UNIQUE (movie_id, hash)
+);
+
+CREATE INDEX IF NOT EXISTS movie_images_hash_idx ON movie_images (hash);
@@ -0,0 +1,5 @@
+-- A reserved key whose request never finished (the server crashed, or the
+-- response couldn't be stored) can be taken over by a retry of the same
+-- request once its lease runs out, rather than being stuck until it expires.
+-- Keys already in progress get a lease that has already run out.
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS leased_until timestamp(0) with time zone NOT NULL DEFAULT NOW();
@@ -0,0 +1,28 @@
+DROP TRIGGER IF EXISTS movies_revision_delete ON movies;
+
+CREATE OR REPLACE FUNCTION record_movie_revision() RETURNS trigger AS $$
+DECLARE
+    revision_action text := nullif(current_setting('greenlight.action', true), '');
+BEGIN
+    IF revision_action IS NULL THEN
+        IF TG_OP = 'INSERT' THEN
+            revision_action := 'create';
+        ELSIF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+            revision_action := 'delete';
+        ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+            revision_action := 'restore';
+        ELSE
+            revision_action := 'update';
+        END IF;
+    END IF;
+
+    INSERT INTO movie_revisions (movie_id, version, action, actor, snapshot)
+    VALUES (NEW.id, NEW.version, revision_action, nullif(current_setting('greenlight.actor', true), ''), to_jsonb(NEW));
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DELETE FROM movie_revisions WHERE movie_id NOT IN (SELECT id FROM movies);
+ALTER TABLE movie_revisions ADD CONSTRAINT movie_revisions_movie_id_fkey
+    FOREIGN KEY (movie_id) REFERENCES movies ON DELETE CASCADE;
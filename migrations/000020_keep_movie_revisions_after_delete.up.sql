@@ -0,0 +1,39 @@
+-- A movie's history outlives it: purging it from the trash (or merging it into
+-- another movie) keeps its revisions and ends them with one more, holding the
+-- movie as it was when it was deleted.
+ALTER TABLE movie_revisions DROP CONSTRAINT IF EXISTS movie_revisions_movie_id_fkey;
+
+CREATE OR REPLACE FUNCTION record_movie_revision() RETURNS trigger AS $$
+DECLARE
+    revision_action text := nullif(current_setting('greenlight.action', true), '');
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO movie_revisions (movie_id, version, action, actor, snapshot)
+        VALUES (OLD.id, OLD.version + 1, coalesce(revision_action, 'purge'), nullif(current_setting('greenlight.actor', true), ''),
+            jsonb_set(to_jsonb(OLD), '{version}', to_jsonb(OLD.version + 1)));
+
+        RETURN OLD;
+    END IF;
+
+    IF revision_action IS NULL THEN
+        IF TG_OP = 'INSERT' THEN
+            revision_action := 'create';
+        ELSIF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+            revision_action := 'delete';
+        ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+            revision_action := 'restore';
+        ELSE
+            revision_action := 'update';
+        END IF;
+    END IF;
+
+    INSERT INTO movie_revisions (movie_id, version, action, actor, snapshot)
+    VALUES (NEW.id, NEW.version, revision_action, nullif(current_setting('greenlight.actor', true), ''), to_jsonb(NEW));
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER movies_revision_delete
+    AFTER DELETE ON movies
+    FOR EACH ROW EXECUTE FUNCTION record_movie_revision();
@@ -0,0 +1,4 @@
+-- Title suggestions match titles starting with what was typed with
+-- lower(title) LIKE 'prefix%', which the trigram index can't answer. The
+-- pattern operator class lets a btree index serve it in any collation.
+CREATE INDEX IF NOT EXISTS movies_title_lower_prefix_idx ON movies (lower(title) text_pattern_ops);
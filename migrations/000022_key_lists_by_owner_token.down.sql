@@ -0,0 +1,2 @@
+UPDATE lists SET owner = '' WHERE owner IS NULL;
+ALTER TABLE lists ALTER COLUMN owner SET NOT NULL;
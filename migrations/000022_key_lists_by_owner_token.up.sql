@@ -0,0 +1,6 @@
+-- Lists used to belong to whatever X-Actor header or client address made them,
+-- which anyone can send. They now belong to the SHA-256 of a secret owner
+-- token. Lists made before can't be tied to a token, so they are left without
+-- an owner: public ones can still be read, and nobody can change them.
+ALTER TABLE lists ALTER COLUMN owner DROP NOT NULL;
+UPDATE lists SET owner = NULL;